@@ -1,30 +1,81 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	clientgocache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 
-	"github.com/gpucloud/node-topology-manager/pkg/controller"
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/config"
+	ctrl "github.com/gpucloud/node-topology-manager/pkg/controller"
+	"github.com/gpucloud/node-topology-manager/pkg/leader"
+	"github.com/gpucloud/node-topology-manager/pkg/recorder"
 	"github.com/gpucloud/node-topology-manager/pkg/routes"
 	"github.com/gpucloud/node-topology-manager/pkg/scheduler"
 	"github.com/gpucloud/node-topology-manager/pkg/signals"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+	"github.com/gpucloud/node-topology-manager/pkg/version"
+	"github.com/gpucloud/node-topology-manager/pkg/webhook"
 	"github.com/julienschmidt/httprouter"
 )
 
 var (
 	masterURL  string
 	kubeconfig string
+	configFile string
+
+	// conf is the default configuration, overridden by the configuration
+	// file and then by the flags set on the command line
+	conf = config.Default()
 )
 
+// windowsFlag sets the semicolon separated maintenance windows
+type windowsFlag struct {
+	windows *[]string
+}
+
+func (f windowsFlag) String() string {
+	if f.windows == nil {
+		return ""
+	}
+	return strings.Join(*f.windows, ";")
+}
+
+func (f windowsFlag) Set(value string) error {
+	*f.windows = nil
+	for _, w := range strings.Split(value, ";") {
+		if w = strings.TrimSpace(w); w != "" {
+			*f.windows = append(*f.windows, w)
+		}
+	}
+	return nil
+}
+
 func main() {
 	klog.InitFlags(nil)
 	flag.Parse()
+	if configFile != "" {
+		if err := config.LoadFile(configFile, conf); err != nil {
+			klog.Fatalf("Failed to load the configuration: %v", err)
+		}
+		// the flags set on the command line override the file
+		flag.Parse()
+	}
+	if errs := config.Validate(conf); len(errs) > 0 {
+		klog.Fatalf("Invalid configuration: %v", errs.ToAggregate())
+	}
+	klog.Infof("node-topology-sched %s", version.Get())
+	utils.Resources = conf.Cache.Resources
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
@@ -39,26 +90,258 @@ func main() {
 		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
-	informerFactory := informers.NewSharedInformerFactory(kubeClient, 30*time.Second)
-	controller, err := controller.NewController(kubeClient, informerFactory, stopCh)
+	resync := conf.Controller.ResyncPeriod.Duration
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, resync)
+	controller, err := ctrl.NewController(kubeClient, informerFactory, stopCh)
 	if err != nil {
 		klog.Fatalf("Failed to start due to %v", err)
 	}
 
-	go controller.Run(2, stopCh)
+	// the templates may use the link types of any managed resource
+	linkTypes := map[string]string{}
+	for _, r := range utils.Resources {
+		for name, key := range r.LinkTypes {
+			linkTypes[name] = key
+		}
+	}
+	controller.GetSchedulerCache().GetTemplates().SetLinkTypes(linkTypes)
+
+	if templateConfigMap := conf.Controller.TemplateConfigMap; templateConfigMap != "" {
+		ns, name, err := clientgocache.SplitMetaNamespaceKey(templateConfigMap)
+		if err != nil {
+			klog.Fatalf("Invalid template ConfigMap %s: %v", templateConfigMap, err)
+		}
+		if err := controller.WatchTemplates(ns, name, resync, stopCh); err != nil {
+			klog.Fatalf("Failed to watch the topology templates: %v", err)
+		}
+	}
+
+	reloader := config.NewReloader(controller.GetSchedulerCache(), conf)
+	source := "flags"
+	if configFile != "" {
+		source = configFile
+	}
+	reloader.Apply(conf, source)
+	if configFile != "" {
+		go reloader.ReloadOnSignal(configFile, signals.SetupReloadHandler(), stopCh)
+	}
+	if configMap := conf.Controller.ConfigMap; configMap != "" {
+		ns, name, err := clientgocache.SplitMetaNamespaceKey(configMap)
+		if err != nil {
+			klog.Fatalf("Invalid configuration ConfigMap %s: %v", configMap, err)
+		}
+		if err := reloader.WatchConfigMap(kubeClient, ns, name, resync, stopCh); err != nil {
+			klog.Fatalf("Failed to watch the configuration: %v", err)
+		}
+	}
+
+	// background are the goroutines waited for on shutdown
+	var background sync.WaitGroup
+
+	// the elector keeps renewing the lease while the binds are drained on
+	// shutdown, stopElector stops it and waits for the lease to be released
+	var elector *leader.Elector
+	stopElector := func() {}
+	if le := conf.Controller.LeaderElection; le.Enabled {
+		elector, err = leader.NewElector(kubeClient, leader.Config{
+			Namespace:     le.Namespace,
+			Name:          le.Name,
+			Identity:      le.Identity,
+			Address:       le.Address,
+			LeaseDuration: le.LeaseDuration.Duration,
+			RenewDeadline: le.RenewDeadline.Duration,
+			RetryPeriod:   le.RetryPeriod.Duration,
+		})
+		if err != nil {
+			klog.Fatalf("Invalid leader election: %v", err)
+		}
+		controller.SetElector(elector)
+		electorStopCh := make(chan struct{})
+		electorDone := make(chan struct{})
+		go func() {
+			defer close(electorDone)
+			elector.Run(electorStopCh)
+		}()
+		stopElector = func() {
+			close(electorStopCh)
+			<-electorDone
+		}
+	}
+
+	if conf.Controller.TaintDegradedNodes {
+		controller.TaintDegradedNodes()
+	}
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		controller.Run(conf.Controller.Workers, stopCh)
+	}()
+
+	if d := conf.Controller.Descheduler; d.Enabled {
+		maxPriority := int32(d.MaxPriority)
+		deschedulerCfg := &ctrl.DeschedulerConfig{
+			Interval:         d.Interval.Duration,
+			EvictionInterval: d.EvictionInterval.Duration,
+			DryRun:           d.DryRun,
+			Options: cache.DefragOptions{
+				IslandSize:     d.IslandSize,
+				MinLinkQuality: d.MinLinkQuality,
+				MaxMigrations:  d.MaxMigrations,
+				MaxPriority:    &maxPriority,
+			},
+		}
+		for _, s := range d.Windows {
+			w, err := ctrl.ParseMaintenanceWindow(s)
+			if err != nil {
+				klog.Fatalf("Invalid descheduler window: %v", err)
+			}
+			deschedulerCfg.Windows = append(deschedulerCfg.Windows, w)
+		}
+		go controller.RunDescheduler(deschedulerCfg, stopCh)
+	}
 
 	topoPriority := scheduler.NewTopoSchedulerPriority("topo-scheduler", kubeClient, controller.GetSchedulerCache())
 
+	topoPredicate := scheduler.NewTopoSchedulerPredicate("topo-scheduler", controller.GetSchedulerCache())
+	topoBind := scheduler.NewTopoSchedulerBind("topo-scheduler", kubeClient, controller.GetSchedulerCache())
+
+	var rec *recorder.Recorder
+	if r := conf.Server.Record; r.File != "" {
+		if rec, err = recorder.NewRecorder(r.File, r.MaxBytes, r.MaxFiles); err != nil {
+			klog.Fatalf("Failed to open the record file %s: %v", r.File, err)
+		}
+		defer rec.Close()
+	}
+
 	router := httprouter.New()
-	routes.AddPriority(router, topoPriority)
+	routes.AddPredicate(router, topoPredicate)
+	routes.AddPriority(router, topoPriority, rec)
+	routes.AddBind(router, topoBind, elector)
+	routes.AddDeviceStatus(router, topoPriority)
+	routes.AddDevices(router, topoPriority, elector)
+	routes.AddNodeTopo(router, topoPriority)
+	routes.AddMetrics(router)
+	routes.AddVersion(router)
+	routes.AddHealth(router, controller)
+	routes.AddPreferredAllocation(router, topoPriority)
+	routes.AddWhatIf(router, topoPriority)
+	routes.AddCapacity(router, topoPriority)
+	routes.AddDefrag(router, topoPriority)
+	routes.AddConfig(router, topoPriority)
+
+	if wh := conf.Server.Webhook; wh.Address != "" {
+		mutator := webhook.NewMutator(wh.SchedulerName, wh.PlacementStrategy, webhook.DefaultTolerations, controller.GetSchedulerCache())
+		go func() {
+			if err := webhook.ListenAndServeTLS(wh.Address, wh.CertFile, wh.KeyFile, wh.Host, mutator, stopCh); err != nil {
+				klog.Fatal(err)
+			}
+		}()
+	}
 
-	klog.Infof("server starting on the port :3767")
-	if err := http.ListenAndServe(":3767", router); err != nil {
-		klog.Fatal(err)
+	server := &http.Server{
+		Addr:    conf.Server.Address,
+		Handler: router,
 	}
+	go func() {
+		klog.Infof("server starting on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatal(err)
+		}
+	}()
+
+	<-stopCh
+	shutdown(server, controller, &background, stopElector)
+}
+
+// shutdown drains the requests in flight, the binds among them, stops the
+// controller and waits for its writes, all within the shutdown timeout.
+// The leadership is given up last, so no other replica binds before the
+// writes of this one are done.
+func shutdown(server *http.Server, controller *ctrl.Controller, background *sync.WaitGroup, stopElector func()) {
+	shutdownTimeout := conf.Server.ShutdownTimeout.Duration
+	klog.Infof("Shutting down, waiting up to %v", shutdownTimeout)
+	deadline := time.Now().Add(shutdownTimeout)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		klog.Warningf("Failed to drain the requests in flight: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		klog.Warningf("The controller is not stopped in %v", shutdownTimeout)
+	}
+
+	if err := controller.WaitForWrites(time.Until(deadline)); err != nil {
+		klog.Warningf("Failed to flush the writes: %v", err)
+	}
+	stopElector()
+	klog.Infof("Shut down")
+	klog.Flush()
 }
 
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&configFile, "config", "", "Path to the YAML configuration file, see docs/extender-config.yaml. The flags set on the command line override it on start, its scoring and health rules are reloaded on SIGHUP without them.")
+
+	flag.StringVar(&conf.Server.Address, "address", conf.Server.Address, "The address to serve the scheduler extender on.")
+	flag.DurationVar(&conf.Server.ShutdownTimeout.Duration, "shutdown-timeout", conf.Server.ShutdownTimeout.Duration, "How long to wait for the requests in flight and the pending writes on shutdown.")
+	flag.StringVar(&conf.Server.Webhook.SchedulerName, "scheduler-name", conf.Server.Webhook.SchedulerName, "The scheduler name injected into the GPU topology pods by the webhook.")
+	flag.StringVar(&conf.Server.Webhook.Address, "webhook-addr", conf.Server.Webhook.Address, "The address to serve the mutating admission webhook on, e.g. :8443. The webhook is disabled if empty.")
+	flag.StringVar(&conf.Server.Webhook.CertFile, "webhook-tls-cert-file", conf.Server.Webhook.CertFile, "The TLS certificate of the webhook. A self-signed certificate is generated if empty.")
+	flag.StringVar(&conf.Server.Webhook.KeyFile, "webhook-tls-private-key-file", conf.Server.Webhook.KeyFile, "The TLS private key of the webhook.")
+	flag.StringVar(&conf.Server.Webhook.Host, "webhook-host", conf.Server.Webhook.Host, "The host name of the self-signed webhook certificate.")
+	flag.StringVar(&conf.Server.Webhook.PlacementStrategy, "webhook-placement-strategy", conf.Server.Webhook.PlacementStrategy, "The default placement strategy annotation injected by the webhook.")
+	flag.StringVar(&conf.Server.Record.File, "record-file", conf.Server.Record.File, "Record every priority call with the cache state it was scored against to this file, for replay with topo-replay. Recording is disabled if empty.")
+	flag.Int64Var(&conf.Server.Record.MaxBytes, "record-max-bytes", conf.Server.Record.MaxBytes, "The size of the record file after which it's rotated.")
+	flag.IntVar(&conf.Server.Record.MaxFiles, "record-max-files", conf.Server.Record.MaxFiles, "The number of rotated record files to keep.")
+
+	flag.IntVar(&conf.Controller.Workers, "workers", conf.Controller.Workers, "The number of the controller workers.")
+	flag.DurationVar(&conf.Controller.ResyncPeriod.Duration, "resync-period", conf.Controller.ResyncPeriod.Duration, "The resync period of the informers.")
+	flag.StringVar(&conf.Controller.ConfigMap, "config-configmap", conf.Controller.ConfigMap, "The namespace/name of the ConfigMap whose config.yaml holds a configuration file, its scoring and health rules are applied on every change.")
+	flag.StringVar(&conf.Controller.TemplateConfigMap, "template-configmap", conf.Controller.TemplateConfigMap, "The namespace/name of the ConfigMap which contains the topology templates of the server models.")
+	flag.BoolVar(&conf.Controller.TaintDegradedNodes, "taint-degraded-nodes", conf.Controller.TaintDegradedNodes, "Taint the nodes whose GPU links are worse than expected with "+utils.TaintDegradedTopology+":PreferNoSchedule.")
+
+	le := &conf.Controller.LeaderElection
+	if hostname, err := os.Hostname(); err == nil {
+		le.Identity = hostname
+	}
+	flag.BoolVar(&le.Enabled, "leader-elect", le.Enabled, "Elect a leader among the replicas with a Lease. All the replicas serve the filter and the priority, only the leader binds, cordons, evicts and taints.")
+	flag.StringVar(&le.Namespace, "leader-elect-namespace", le.Namespace, "The namespace of the leader election Lease.")
+	flag.StringVar(&le.Name, "leader-elect-name", le.Name, "The name of the leader election Lease.")
+	flag.StringVar(&le.Identity, "leader-elect-identity", le.Identity, "The identity of this replica in the leader election.")
+	flag.StringVar(&le.Address, "leader-elect-address", le.Address, "The address the followers forward the binds to while this replica leads, e.g. http://$(POD_IP):3767. The followers refuse the binds if empty.")
+	flag.DurationVar(&le.LeaseDuration.Duration, "leader-elect-lease-duration", le.LeaseDuration.Duration, "How long the followers wait before taking over a lease which isn't renewed.")
+	flag.DurationVar(&le.RenewDeadline.Duration, "leader-elect-renew-deadline", le.RenewDeadline.Duration, "How long the leader retries to renew its lease before it steps down.")
+	flag.DurationVar(&le.RetryPeriod.Duration, "leader-elect-retry-period", le.RetryPeriod.Duration, "The interval between two tries to acquire or renew the lease.")
+
+	d := &conf.Controller.Descheduler
+	flag.BoolVar(&d.Enabled, "descheduler", d.Enabled, "Evict the pods of the defragmentation plan to restore intact GPU islands.")
+	flag.BoolVar(&d.DryRun, "descheduler-dry-run", d.DryRun, "Log the evictions of the descheduler without evicting.")
+	flag.DurationVar(&d.Interval.Duration, "descheduler-interval", d.Interval.Duration, "The interval between two defragmentation plans.")
+	flag.DurationVar(&d.EvictionInterval.Duration, "descheduler-eviction-interval", d.EvictionInterval.Duration, "The minimum time between two evictions of the descheduler.")
+	flag.Var(windowsFlag{&d.Windows}, "descheduler-windows", "The semicolon separated maintenance windows of the descheduler in the local time, e.g. \"Sat,Sun 01:00-05:00;22:00-02:00\". Any time if empty.")
+	flag.IntVar(&d.IslandSize, "descheduler-island-size", d.IslandSize, "The number of free GPUs of an island restored by the descheduler.")
+	flag.IntVar(&d.MinLinkQuality, "descheduler-min-link-quality", d.MinLinkQuality, "The minimum average link score in [0, 100] of an island.")
+	flag.IntVar(&d.MaxMigrations, "descheduler-max-migrations", d.MaxMigrations, "The maximum number of evictions of a defragmentation plan.")
+	flag.IntVar(&d.MaxPriority, "descheduler-max-priority", d.MaxPriority, "The pods of a higher priority are never evicted by the descheduler.")
+
+	flag.Uint64Var(&conf.Cache.Health.MaxECCErrors, "health-max-ecc-errors", conf.Cache.Health.MaxECCErrors, "The GPUs with more uncorrectable ECC errors are excluded from scheduling.")
+	flag.UintVar(&conf.Cache.Health.MaxTemperature, "health-max-temperature", conf.Cache.Health.MaxTemperature, "The GPUs with a higher temperature are excluded from scheduling, 0 disables the rule.")
+	flag.IntVar(&conf.Cache.Health.ThrottlePersistence, "health-throttle-persistence", conf.Cache.Health.ThrottlePersistence, "The GPUs reporting HW thermal slowdown in this number of consecutive statuses are excluded from scheduling, 0 disables the rule.")
+
+	flag.IntVar(&conf.Scoring.ThermalWeight, "thermal-weight", conf.Scoring.ThermalWeight, "The weight of the GPU power headroom and temperature relative to the link quality, whose weight is 1. 0 disables the thermal scoring.")
+	flag.StringVar(&conf.Scoring.DefaultStrategy, "default-placement-strategy", conf.Scoring.DefaultStrategy, "The placement strategy of the pods without the strategy annotation, binpack or spread.")
+	flag.StringVar(&conf.Scoring.LinkScorer, "link-scorer", conf.Scoring.LinkScorer, "How the links of the GPUs are scored, rank by the link score table or bandwidth by the estimated bandwidth of their best ring.")
+	flag.Float64Var(&conf.Scoring.ReferenceBandwidth, "reference-bandwidth", conf.Scoring.ReferenceBandwidth, "The ring bandwidth in GB/s which gets the best score of the bandwidth link scorer.")
+	flag.UintVar(&conf.Scoring.ReferenceTemperature, "reference-temperature", conf.Scoring.ReferenceTemperature, "The GPU temperature which gets the lowest thermal score.")
 }
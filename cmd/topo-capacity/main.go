@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+)
+
+var (
+	server         string
+	resource       string
+	sizes          string
+	minLinkQuality int
+	output         string
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	query := url.Values{}
+	if resource != "" {
+		query.Set("resource", resource)
+	}
+	query.Set("sizes", sizes)
+	query.Set("minLinkQuality", fmt.Sprintf("%d", minLinkQuality))
+	resp, err := http.Get(strings.TrimSuffix(server, "/") + "/topo-scheduler/capacity?" + query.Encode())
+	if err != nil {
+		klog.Fatalf("Failed to get the capacity report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		klog.Fatalf("Failed to read the capacity report: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		klog.Fatalf("Failed to get the capacity report: %s: %s", resp.Status, data)
+	}
+
+	switch output {
+	case "json":
+		os.Stdout.Write(data)
+	default:
+		var report cache.CapacityReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			klog.Fatalf("Failed to decode the capacity report: %v", err)
+		}
+		fmt.Printf("%s sets with a link quality of at least %d\n", report.Resource, report.MinLinkQuality)
+		report.WriteTable(os.Stdout)
+	}
+}
+
+func init() {
+	flag.StringVar(&server, "server", "http://localhost:3767", "The address of the topology scheduler extender.")
+	flag.StringVar(&resource, "resource", "", "The GPU resource of the nodes, the default one of the extender if empty.")
+	flag.StringVar(&sizes, "sizes", "1,2,4,8", "The comma separated GPU counts of the sets.")
+	flag.IntVar(&minLinkQuality, "min-link-quality", 0, "The minimum average link score in [0, 100] of a set.")
+	flag.StringVar(&output, "output", "table", "The report format, table or json.")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/recorder"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] RECORD_FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var total, changed int
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			klog.Fatalf("Failed to open the record file %s: %v", path, err)
+		}
+		records, err := recorder.ReadRecords(f)
+		f.Close()
+		if err != nil {
+			klog.Fatalf("Failed to read the record file %s: %v", path, err)
+		}
+
+		for i, rec := range records {
+			total++
+			_, diffs, err := recorder.Replay(rec)
+			if err != nil {
+				klog.Fatalf("Failed to replay record %d of %s: %v", i+1, path, err)
+			}
+			if len(diffs) == 0 {
+				continue
+			}
+			changed++
+			pod := "<nil>"
+			if rec.Args.Pod != nil {
+				pod = rec.Args.Pod.Namespace + "/" + rec.Args.Pod.Name
+			}
+			fmt.Printf("%s:%d pod %s recorded at %s\n", path, i+1, pod, rec.Time.Format("2006-01-02T15:04:05Z07:00"))
+			for _, d := range diffs {
+				fmt.Printf("  %s\n", d)
+			}
+		}
+	}
+
+	fmt.Printf("%d of %d records scored differently\n", changed, total)
+	if changed > 0 {
+		os.Exit(1)
+	}
+}
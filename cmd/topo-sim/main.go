@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+
+	"github.com/gpucloud/node-topology-manager/pkg/simulator"
+)
+
+var (
+	clusterFile string
+	traceFile   string
+	output      string
+	islandSize  int
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	var cluster simulator.Cluster
+	if err := readYAML(clusterFile, &cluster); err != nil {
+		klog.Fatalf("Failed to read the cluster %s: %v", clusterFile, err)
+	}
+	var trace simulator.Trace
+	if err := readYAML(traceFile, &trace); err != nil {
+		klog.Fatalf("Failed to read the trace %s: %v", traceFile, err)
+	}
+
+	sim, err := simulator.New(&cluster, filepath.Dir(clusterFile), islandSize)
+	if err != nil {
+		klog.Fatalf("Failed to build the cluster: %v", err)
+	}
+	report, err := sim.Run(&trace)
+	if err != nil {
+		klog.Fatalf("Invalid trace %s: %v", traceFile, err)
+	}
+
+	switch output {
+	case "json":
+		data, _ := json.MarshalIndent(report, "", "  ")
+		os.Stdout.Write(append(data, '\n'))
+	default:
+		report.WriteTable(os.Stdout)
+	}
+}
+
+func readYAML(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+func init() {
+	flag.StringVar(&clusterFile, "cluster", "cluster.yaml", "Path to the YAML description of the nodes.")
+	flag.StringVar(&traceFile, "trace", "trace.yaml", "Path to the YAML workload trace of the pod arrivals and departures.")
+	flag.StringVar(&output, "output", "table", "The report format, table or json.")
+	flag.IntVar(&islandSize, "island-size", 8, "The number of free GPUs on a node counted as an island.")
+}
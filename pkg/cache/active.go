@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// ActiveConfig is the reloadable configuration in use, the scoring config
+// and the health rules
+type ActiveConfig struct {
+	// Version identifies the content of the configuration, it's the same
+	// for the same scoring config and health rules whatever their source
+	Version string `json:"version"`
+	// Source the configuration was loaded from, e.g. the configuration file
+	// or the ConfigMap
+	Source   string         `json:"source"`
+	LoadedAt time.Time      `json:"loadedAt"`
+	Scoring  *ScoringConfig `json:"scoring"`
+	Health   *HealthRules   `json:"health"`
+}
+
+// ApplyConfig replaces the scoring config and the health rules together, a
+// priority call sees either the old or the new ones. They must not be
+// modified once applied.
+func (cache *SchedulerCache) ApplyConfig(scoring *ScoringConfig, health *HealthRules, source string) *ActiveConfig {
+	cache.nLock.Lock()
+	defer cache.nLock.Unlock()
+
+	cache.scoring = scoring
+	cache.healthRules = health
+	cache.configSource = source
+	cache.configLoadedAt = time.Now()
+	return cache.activeConfig()
+}
+
+// ActiveConfig returns the reloadable configuration in use
+func (cache *SchedulerCache) ActiveConfig() *ActiveConfig {
+	cache.nLock.RLock()
+	defer cache.nLock.RUnlock()
+	return cache.activeConfig()
+}
+
+// activeConfig the caller should hold the lock
+func (cache *SchedulerCache) activeConfig() *ActiveConfig {
+	return &ActiveConfig{
+		Version:  configVersion(cache.scoring, cache.healthRules),
+		Source:   cache.configSource,
+		LoadedAt: cache.configLoadedAt,
+		Scoring:  cache.scoring,
+		Health:   cache.healthRules,
+	}
+}
+
+// configVersion hashes the configuration, the maps are encoded sorted
+func configVersion(scoring *ScoringConfig, health *HealthRules) string {
+	data, _ := json.Marshal(struct {
+		Scoring *ScoringConfig `json:"scoring"`
+		Health  *HealthRules   `json:"health"`
+	}{scoring, health})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	// EventReasonInvalidTopology is recorded on the node with an invalid topology annotation
+	EventReasonInvalidTopology = "InvalidTopology"
+)
+
+// UpdateNodeTopology decodes and validates the topology annotation of the
+// managed resource of the node, the cached topology is only replaced by a
+// valid one. The node without the topology annotation may annotate its model
+// and be expanded from the template.
+func (cache *SchedulerCache) UpdateNodeTopology(node *v1.Node) error {
+	r, ok := utils.GetNodeResource(node)
+	if !ok {
+		return nil
+	}
+
+	var (
+		t   *Topology
+		err error
+	)
+	if val, ok := node.Annotations[r.TopologyAnnotation]; ok {
+		t, err = DecodeTopologyAnnotation(val)
+	} else {
+		t, err = cache.templates.ExpandAnnotation(node.Annotations[r.TemplateAnnotation], r.LinkTypes)
+	}
+	if err != nil {
+		klog.Errorf("Failed to decode node %s's topology: %v", node.Name, err)
+		cache.recordEvent(node, v1.EventTypeWarning, EventReasonInvalidTopology, "Failed to decode the topology annotation: %v", err)
+		return err
+	}
+	if errs := ValidateTopology(t); len(errs) > 0 {
+		err = errs.ToAggregate()
+		klog.Errorf("Node %s's topology is invalid: %v", node.Name, err)
+		cache.recordEvent(node, v1.EventTypeWarning, EventReasonInvalidTopology, "The topology annotation is invalid: %v", err)
+		return err
+	}
+
+	if err = cache.AddOrUpdateNode(node.Name, r.Name, t); err != nil {
+		return fmt.Errorf("failed to add or update node %s: %v", node.Name, err)
+	}
+	return nil
+}
+
+func (cache *SchedulerCache) recordEvent(node *v1.Node, eventtype, reason, messageFmt string, args ...interface{}) {
+	if cache.recorder == nil {
+		return
+	}
+	cache.recorder.Eventf(node, eventtype, reason, messageFmt, args...)
+}
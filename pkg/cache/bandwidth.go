@@ -0,0 +1,75 @@
+package cache
+
+const (
+	// LinkScorerRank scores a subset by the average rank of its pair links
+	LinkScorerRank = "rank"
+	// LinkScorerBandwidth scores a subset by the bottleneck bandwidth of its
+	// best ring, see ringScore
+	LinkScorerBandwidth = "bandwidth"
+
+	// DefaultReferenceBandwidth is the ring bandwidth in GB/s scored
+	// maxSubsetScore, the one of 6 NVLinks
+	DefaultReferenceBandwidth = 6 * NVLinkBandwidth
+
+	// defaultPCIeBandwidth is the bandwidth in GB/s of the GPU whose PCIe
+	// bandwidth isn't reported, the one of a PCIe Gen3 x16 link
+	defaultPCIeBandwidth = 15.75
+)
+
+// pcieEfficiency is the share of the PCIe bandwidth of the GPUs achieved
+// across the PCIe link kinds
+var pcieEfficiency = map[LinkKind]float64{
+	LinkKindPCIeCrossCPU:     0.4,
+	LinkKindPCIeSameCPU:      0.6,
+	LinkKindPCIeHostBridge:   0.8,
+	LinkKindPCIeMultiSwitch:  0.9,
+	LinkKindPCIeSingleSwitch: 1,
+	LinkKindBoard:            1,
+}
+
+// pcieBandwidth is the bandwidth in GB/s of the PCIe link of the device,
+// which NVML reports in MB/s from the PCIe generation and width
+func pcieBandwidth(d *Device) float64 {
+	if d.PCI.Bandwidth == nil || *d.PCI.Bandwidth == 0 {
+		return defaultPCIeBandwidth
+	}
+	return float64(*d.PCI.Bandwidth) / 1000
+}
+
+// pairBandwidth estimates the achievable bandwidth in GB/s between two
+// devices from the kind and the count of their link. The PCIe links are
+// bounded by the slower of the two devices' PCIe bandwidth.
+func pairBandwidth(a, b *Device) float64 {
+	l := linkBetween(a, b)
+	if l.fabric() {
+		return l.nominalBandwidth()
+	}
+	pcie := pcieBandwidth(a)
+	if bw := pcieBandwidth(b); bw < pcie {
+		pcie = bw
+	}
+	return pcie * pcieEfficiency[l.Kind]
+}
+
+// bandwidthScorer scores the link of two devices in [0, maxSubsetScore] by
+// its estimated bandwidth relative to the reference bandwidth of cfg, so the
+// scores of the nodes of different GPU models are comparable. The degraded
+// link is down-weighted as it's likely to be unstable. The caller should
+// hold the lock.
+func (n *NodeInfo) bandwidthScorer(cfg *ScoringConfig) pairScoreFunc {
+	reference := cfg.ReferenceBandwidth
+	if reference <= 0 {
+		reference = DefaultReferenceBandwidth
+	}
+	return func(a, b *Device) int {
+		bw := pairBandwidth(a, b)
+		if _, ok := n.degraded[pairKey(a.UUID, b.UUID)]; ok {
+			bw /= 2
+		}
+		score := int(bw * maxSubsetScore / reference)
+		if score > maxSubsetScore {
+			score = maxSubsetScore
+		}
+		return score
+	}
+}
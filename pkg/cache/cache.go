@@ -1,13 +1,17 @@
 package cache
 
 import (
-	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 
 	"github.com/gpucloud/node-topology-manager/pkg/utils"
@@ -27,15 +31,40 @@ type SchedulerCache struct {
 	// record the knownPod, it will be added when annotation ALIYUN_GPU_ID is added, and will be removed when complete and deleted
 	knownPods map[types.UID]*v1.Pod
 	nLock     *sync.RWMutex
+
+	// recorder records the events of the nodes with invalid topology
+	recorder record.EventRecorder
+
+	// templates expand the topology of the nodes which only annotate their model
+	templates *TemplateRegistry
+
+	// degradationHandler is notified when the degraded links of a node change
+	degradationHandler DegradationHandler
+
+	// healthRules decide the schedulable GPUs from their status
+	healthRules *HealthRules
+
+	// scoring weights the components of the GPU subset score
+	scoring *ScoringConfig
+
+	// configSource and configLoadedAt describe the configuration applied last
+	configSource   string
+	configLoadedAt time.Time
 }
 
-func NewSchedulerCache(nLister corelisters.NodeLister, pLister corelisters.PodLister) *SchedulerCache {
+func NewSchedulerCache(nLister corelisters.NodeLister, pLister corelisters.PodLister, recorder record.EventRecorder) *SchedulerCache {
 	return &SchedulerCache{
-		nodes:      make(map[string]*NodeInfo),
-		nodeLister: nLister,
-		podLister:  pLister,
-		knownPods:  make(map[types.UID]*v1.Pod),
-		nLock:      new(sync.RWMutex),
+		nodes:          make(map[string]*NodeInfo),
+		nodeLister:     nLister,
+		podLister:      pLister,
+		recorder:       recorder,
+		templates:      NewTemplateRegistry(),
+		healthRules:    DefaultHealthRules(),
+		scoring:        DefaultScoringConfig(),
+		configSource:   "default",
+		configLoadedAt: time.Now(),
+		knownPods:      make(map[types.UID]*v1.Pod),
+		nLock:          new(sync.RWMutex),
 	}
 }
 
@@ -48,20 +77,8 @@ func (cache *SchedulerCache) BuildCache() error {
 		return err
 	}
 	for _, node := range nodes {
-		var t Topology
-		if val, ok := node.Annotations["nvidia.com/gpu-topo"]; !ok {
-			continue
-		} else {
-			err = json.Unmarshal([]byte(val), &t)
-			if err != nil {
-				klog.Errorf("Failed to decode node's topology: %v", err)
-				continue
-			}
-		}
-		if err = cache.AddOrUpdateNode(node.Name, &t); err != nil {
-			klog.Errorf("Failed to AddOrUpdateNode: %v", node.Name)
-			return err
-		}
+		// the invalid topologies are skipped, they're reported on the node
+		cache.UpdateNodeTopology(node)
 	}
 	pods, err := cache.podLister.List(labels.Everything())
 	if err != nil {
@@ -112,7 +129,7 @@ func (cache *SchedulerCache) AddOrUpdatePod(pod *v1.Pod) error {
 		// put it into known pod
 		cache.rememberPod(pod.UID, podCopy)
 	} else {
-		klog.V(2).Infof("Pod %s in ns %s's gpu id is %d, it's illegal, skip",
+		klog.V(2).Infof("Pod %s in ns %s's gpu id is %s, it's illegal, skip",
 			pod.Name,
 			pod.Namespace,
 			utils.GetGPUIDFromAnnotation(pod))
@@ -121,6 +138,40 @@ func (cache *SchedulerCache) AddOrUpdatePod(pod *v1.Pod) error {
 	return nil
 }
 
+// AssumePod allocates the GPUs of the pod on the node and adds it to the
+// cache before it's bound, the returned copy of the pod has the GPU UUIDs in
+// its annotation and the node name set. The pod must request the resource
+// of the node's GPUs.
+func (cache *SchedulerCache) AssumePod(pod *v1.Pod, nodeName string, gpuTopoNum int64, cfg *ScoringConfig) (*v1.Pod, error) {
+	n, err := cache.GetNodeInfo(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if resource, _ := utils.GetGPUTopoResource(pod); resource != n.Resource() {
+		return nil, fmt.Errorf("pod %s/%s requests %s, the GPUs of node %s are %s",
+			pod.Namespace, pod.Name, resource, nodeName, n.Resource())
+	}
+	uuids, err := n.Allocate(pod, gpuTopoNum, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	assumed := pod.DeepCopy()
+	if assumed.Annotations == nil {
+		assumed.Annotations = map[string]string{}
+	}
+	assumed.Annotations[n.Resource()] = strings.Join(uuids, ",")
+	if utils.GetCommPattern(pod) == utils.CommPatternParameterServer && len(uuids) > 0 {
+		// the GPU order in the container isn't the one of the allocation
+		assumed.Annotations[utils.AnnotationParameterServer] = uuids[0]
+	}
+	assumed.Spec.NodeName = nodeName
+	if err = cache.AddOrUpdatePod(assumed); err != nil {
+		return nil, err
+	}
+	return assumed, nil
+}
+
 // RemovePod remove pod from scheduler cache
 // The lock is in cacheNode
 func (cache *SchedulerCache) RemovePod(pod *v1.Pod) {
@@ -136,26 +187,34 @@ func (cache *SchedulerCache) RemovePod(pod *v1.Pod) {
 	cache.forgetPod(pod.UID)
 }
 
-func (cache *SchedulerCache) AddOrUpdateNode(name string, t *Topology) error {
+func (cache *SchedulerCache) AddOrUpdateNode(name, resource string, t *Topology) error {
 	node, err := cache.nodeLister.Get(name)
 	if err != nil {
 		return err
 	}
 
 	cache.nLock.Lock()
-	defer cache.nLock.Unlock()
-
 	n, ok := cache.nodes[name]
 	if !ok {
 		n = NewNodeInfo(node)
-		n.topology = t
 		cache.nodes[name] = n
-	} else {
-		cache.nodes[name].topology = t
 	}
+	cache.nLock.Unlock()
+
+	links, changed := n.setTopology(resource, t, cache.expectedTopology(resource, t))
+	cache.reportDegradedLinks(node, links, changed)
 	return nil
 }
 
+// RemoveNode forgets the deleted node and its metrics
+func (cache *SchedulerCache) RemoveNode(name string) {
+	cache.nLock.Lock()
+	delete(cache.nodes, name)
+	cache.nLock.Unlock()
+
+	degradedLinksGauge.Delete(name)
+}
+
 // GetNodeInfo Get or build nodeInfo if it doesn't exist
 func (cache *SchedulerCache) GetNodeInfo(name string) (*NodeInfo, error) {
 	node, err := cache.nodeLister.Get(name)
@@ -171,14 +230,67 @@ func (cache *SchedulerCache) GetNodeInfo(name string) (*NodeInfo, error) {
 		n = NewNodeInfo(node)
 		cache.nodes[name] = n
 	} else {
-		n = NewNodeInfo(node)
-		cache.nodes[name] = n
+		n.node = node
 
 		klog.V(2).Infof("debug: GetNodeInfo() uses the existing nodeInfo for %s", name)
 	}
 	return n, nil
 }
 
+// SetDegradationHandler set the handler notified when the degraded links of a node change
+func (cache *SchedulerCache) SetDegradationHandler(h DegradationHandler) {
+	cache.nLock.Lock()
+	defer cache.nLock.Unlock()
+	cache.degradationHandler = h
+}
+
+// GetTemplates get the topology templates
+func (cache *SchedulerCache) GetTemplates() *TemplateRegistry {
+	return cache.templates
+}
+
+// Nodes returns the cached nodes sorted by name
+func (cache *SchedulerCache) Nodes() []*NodeInfo {
+	cache.nLock.RLock()
+	defer cache.nLock.RUnlock()
+
+	nodes := make([]*NodeInfo, 0, len(cache.nodes))
+	for _, n := range cache.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	return nodes
+}
+
+// KnownTopologies returns the number of nodes whose GPU topology is known
+func (cache *SchedulerCache) KnownTopologies() int {
+	var known int
+	for _, n := range cache.Nodes() {
+		n.rwmu.RLock()
+		if len(n.topology.GPUDevice) > 0 {
+			known++
+		}
+		n.rwmu.RUnlock()
+	}
+	return known
+}
+
+// MaxGPUDevices returns the largest number of GPU devices on a single node
+func (cache *SchedulerCache) MaxGPUDevices() int {
+	cache.nLock.RLock()
+	defer cache.nLock.RUnlock()
+
+	var max int
+	for _, n := range cache.nodes {
+		n.rwmu.RLock()
+		if num := len(n.topology.GPUDevice); num > max {
+			max = num
+		}
+		n.rwmu.RUnlock()
+	}
+	return max
+}
+
 func (cache *SchedulerCache) forgetPod(uid types.UID) {
 	cache.nLock.Lock()
 	defer cache.nLock.Unlock()
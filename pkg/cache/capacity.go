@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultCapacitySizes are the GPU counts of the capacity report
+var DefaultCapacitySizes = []int{1, 2, 4, 8}
+
+// CapacityReport counts the disjoint GPU sets which can still be carved out
+// of the free GPUs for each size
+type CapacityReport struct {
+	// Resource of the GPUs, the nodes of the other resources are left out
+	Resource       string          `json:"resource"`
+	MinLinkQuality int             `json:"minLinkQuality"`
+	Sizes          []int           `json:"sizes"`
+	Totals         map[int]int     `json:"totals"`
+	Nodes          []*NodeCapacity `json:"nodes"`
+}
+
+// NodeCapacity is the capacity of a node
+type NodeCapacity struct {
+	Node     string      `json:"node"`
+	FreeGPUs int         `json:"freeGPUs"`
+	Sets     map[int]int `json:"sets"`
+}
+
+// Capacity counts the disjoint sets of size free GPUs whose link quality,
+// the average link score in [0, 100], is at least minLinkQuality. The sets
+// are carved greedily, best first.
+func (n *NodeInfo) Capacity(size, minLinkQuality int, cfg *ScoringConfig) int {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	return n.capacity(n.freeDevices(), size, minLinkQuality, cfg)
+}
+
+// capacity counts the sets in the free devices, the caller should hold the lock
+func (n *NodeInfo) capacity(free []*Device, size, minLinkQuality int, cfg *ScoringConfig) int {
+	return countDisjointSets(free, size, minLinkQuality, n.pairScorer(cfg))
+}
+
+// countDisjointSets carves the best set out of the devices until it's worse
+// than minLinkQuality
+func countDisjointSets(free []*Device, size, minLinkQuality int, pairScore pairScoreFunc) int {
+	score := func(devs []*Device) int {
+		return averagePairScore(devs, pairScore)
+	}
+
+	var count int
+	for len(free) >= size {
+		devs, quality, err := selectSubset(free, nil, size, score)
+		if err != nil || quality < minLinkQuality {
+			break
+		}
+		count++
+
+		chosen := make(map[string]bool, len(devs))
+		for _, d := range devs {
+			chosen[d.UUID] = true
+		}
+		left := make([]*Device, 0, len(free)-len(devs))
+		for _, d := range free {
+			if !chosen[d.UUID] {
+				left = append(left, d)
+			}
+		}
+		free = left
+	}
+	return count
+}
+
+// CapacityReport counts the GPU sets of every size on the cached nodes of
+// the resource
+func (cache *SchedulerCache) CapacityReport(resource string, sizes []int, minLinkQuality int) *CapacityReport {
+	cfg := cache.GetScoringConfig()
+	report := &CapacityReport{
+		Resource:       resource,
+		MinLinkQuality: minLinkQuality,
+		Sizes:          sizes,
+		Totals:         make(map[int]int, len(sizes)),
+		Nodes:          []*NodeCapacity{},
+	}
+	for _, n := range cache.Nodes() {
+		n.rwmu.RLock()
+		if n.resource != resource {
+			n.rwmu.RUnlock()
+			continue
+		}
+		free := n.freeDevices()
+		c := &NodeCapacity{
+			Node:     n.name,
+			FreeGPUs: len(free),
+			Sets:     make(map[int]int, len(sizes)),
+		}
+		for _, size := range sizes {
+			c.Sets[size] = n.capacity(free, size, minLinkQuality, cfg)
+			report.Totals[size] += c.Sets[size]
+		}
+		n.rwmu.RUnlock()
+		report.Nodes = append(report.Nodes, c)
+	}
+	return report
+}
+
+// WriteTable writes the report as an aligned table with a row per node
+func (r *CapacityReport) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	header := []string{"NODE", "FREE"}
+	for _, size := range r.Sizes {
+		header = append(header, fmt.Sprintf("%d-GPU", size))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	var free int
+	for _, c := range r.Nodes {
+		row := []string{c.Node, fmt.Sprintf("%d", c.FreeGPUs)}
+		for _, size := range r.Sizes {
+			row = append(row, fmt.Sprintf("%d", c.Sets[size]))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+		free += c.FreeGPUs
+	}
+
+	row := []string{"TOTAL", fmt.Sprintf("%d", free)}
+	for _, size := range r.Sizes {
+		row = append(row, fmt.Sprintf("%d", r.Totals[size]))
+	}
+	fmt.Fprintln(w, strings.Join(row, "\t"))
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func TestCountDisjointSets(t *testing.T) {
+	// two boards of 8 GPUs on NVLinks, PCIe across the boards
+	n := newTestNodeInfo(16)
+	pairScore := n.pairScorer(DefaultScoringConfig())
+	all := n.topology.GPUDevice
+
+	tests := []struct {
+		name           string
+		free           []*Device
+		size           int
+		minLinkQuality int
+		want           int
+	}{
+		{"boards", all, 8, maxSubsetScore, 2},
+		{"halves of the boards", all, 4, maxSubsetScore, 4},
+		{"sets of 3 on the boards", all, 3, maxSubsetScore, 4},
+		{"sets of 3 across the boards", all, 3, 0, 5},
+		{"the whole node", all, 16, maxSubsetScore, 0},
+		{"the whole node at any quality", all, 16, 0, 1},
+		{"a board partly used", all[3:], 8, maxSubsetScore, 1},
+		{"too few GPUs", all[:2], 4, 0, 0},
+	}
+	for _, test := range tests {
+		if got := countDisjointSets(test.free, test.size, test.minLinkQuality, pairScore); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	free := newNamedTestNodeInfo("free", 8)
+	busy := newNamedTestNodeInfo("busy", 8)
+	useGPUs(busy, newTestPod("busy", utils.DefaultResourceName(), 3), 3)
+	other := newNamedTestNodeInfo("other", 8)
+	other.resource = "amd.com/gpu-topo"
+	c := newTestCache(free, busy, other)
+
+	report := c.CapacityReport(utils.DefaultResourceName(), []int{1, 4, 8}, maxSubsetScore)
+	want := map[int]int{1: 13, 4: 3, 8: 1}
+	for size, count := range want {
+		if report.Totals[size] != count {
+			t.Errorf("%d-GPU sets: got %d, want %d", size, report.Totals[size], count)
+		}
+	}
+	if len(report.Nodes) != 2 || report.Nodes[0].Node != "busy" || report.Nodes[0].FreeGPUs != 5 {
+		t.Errorf("nodes %+v, want busy with 5 free GPUs first", report.Nodes)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// DeviceState is the scheduling state of a GPU on the node
+type DeviceState struct {
+	UUID      string `json:"uuid"`
+	Cordoned  bool   `json:"cordoned"`
+	Unhealthy string `json:"unhealthy,omitempty"`
+	// Pod is the namespace/name of the pod holding the GPU
+	Pod string `json:"pod,omitempty"`
+}
+
+// ParseCordonedDevices parses the cordoned GPU UUIDs from the node annotation
+func ParseCordonedDevices(node *v1.Node) []string {
+	val := node.Annotations[utils.AnnotationCordonedDevices]
+	var uuids []string
+	for _, uuid := range strings.Split(val, ",") {
+		if uuid = strings.TrimSpace(uuid); uuid != "" {
+			uuids = append(uuids, uuid)
+		}
+	}
+	return uuids
+}
+
+// FormatCordonedDevices formats the cordoned GPU UUIDs for the node annotation
+func FormatCordonedDevices(uuids []string) string {
+	sorted := append([]string{}, uuids...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// UpdateCordonedDevices syncs the cordoned GPUs from the node annotation
+func (cache *SchedulerCache) UpdateCordonedDevices(node *v1.Node) error {
+	n, err := cache.GetNodeInfo(node.Name)
+	if err != nil {
+		return err
+	}
+	n.setCordoned(ParseCordonedDevices(node))
+	return nil
+}
+
+func (n *NodeInfo) setCordoned(uuids []string) {
+	n.rwmu.Lock()
+	defer n.rwmu.Unlock()
+
+	cordoned := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		cordoned[uuid] = true
+	}
+	klog.V(2).Infof("Cordoned GPUs of node %s: %v", n.name, uuids)
+	n.cordoned = cordoned
+}
+
+// DeviceStates returns the scheduling state of the GPUs on the node
+func (n *NodeInfo) DeviceStates() []DeviceState {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	states := make([]DeviceState, 0, len(n.topology.GPUDevice))
+	for _, d := range n.topology.GPUDevice {
+		state := DeviceState{
+			UUID:      d.UUID,
+			Cordoned:  n.cordoned[d.UUID],
+			Unhealthy: n.unhealthy[d.UUID],
+		}
+		if pod, ok := n.devs[d.UUID]; ok {
+			state.Pod = pod.Namespace + "/" + pod.Name
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// GetDevicePod returns the pod holding the GPU, nil if it's free
+func (n *NodeInfo) GetDevicePod(uuid string) *v1.Pod {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+	return n.devs[uuid]
+}
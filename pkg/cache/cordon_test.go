@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func TestIsSchedulable(t *testing.T) {
+	n := newTestNodeInfo(4)
+	uuids := deviceUUIDs(n.topology.GPUDevice)
+	n.cordoned[uuids[1]] = true
+	n.unhealthy[uuids[2]] = "XID 79"
+	n.cordoned[uuids[3]] = true
+	n.unhealthy[uuids[3]] = "XID 79"
+
+	for i, want := range []bool{true, false, false, false} {
+		if got := n.isSchedulable(uuids[i]); got != want {
+			t.Errorf("GPU %d: got schedulable %v, want %v", i, got, want)
+		}
+	}
+	if got, err := n.PreferredAllocation(uuids, nil, 2, DefaultScoringConfig()); err == nil {
+		t.Errorf("got %v from a single schedulable GPU, want an error", got)
+	}
+}
+
+func TestUpdateCordonedDevices(t *testing.T) {
+	n := newTestNodeInfo(4)
+	c := newTestCache(n)
+	uuids := deviceUUIDs(n.topology.GPUDevice)
+
+	tests := []struct {
+		annotation string
+		want       []string
+	}{
+		{annotation: uuids[2] + ", " + uuids[0] + ",", want: []string{uuids[0], uuids[2]}},
+		{annotation: uuids[1], want: []string{uuids[1]}},
+		{annotation: ""},
+	}
+	for _, test := range tests {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: n.name, Annotations: map[string]string{
+			utils.AnnotationCordonedDevices: test.annotation,
+		}}}
+		if err := c.UpdateCordonedDevices(node); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range n.DeviceStates() {
+			if s.Cordoned {
+				got = append(got, s.UUID)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got cordoned %v, want %v", test.annotation, got, test.want)
+		}
+	}
+}
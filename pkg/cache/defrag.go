@@ -0,0 +1,443 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// DefragOptions tunes the defragmentation plan
+type DefragOptions struct {
+	// IslandSize is the number of GPUs of an island
+	IslandSize int
+	// MinLinkQuality is the minimum average link score in [0, 100] of an island
+	MinLinkQuality int
+	// MaxMigrations bounds the size of the plan, 0 for no bound
+	MaxMigrations int
+	// MaxPriority protects the pods of a higher priority, nil moves any pod
+	MaxPriority *int32
+	// PDBs are the disruption budgets the plan must respect
+	PDBs []*policy.PodDisruptionBudget
+}
+
+// Migration moves a pod to another node
+type Migration struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	Priority  int32     `json:"priority"`
+	From      string    `json:"from"`
+	FromGPUs  []string  `json:"fromGPUs"`
+	To        string    `json:"to"`
+	ToGPUs    []string  `json:"toGPUs"`
+}
+
+// PinnedPod is a pod the plan can't move
+type PinnedPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Node      string `json:"node"`
+	Reason    string `json:"reason"`
+}
+
+// DefragPlan is a list of migrations which restore intact islands, the
+// migrations of a node are meant to be done together
+type DefragPlan struct {
+	IslandSize     int          `json:"islandSize"`
+	MinLinkQuality int          `json:"minLinkQuality"`
+	IslandsBefore  int          `json:"islandsBefore"`
+	IslandsAfter   int          `json:"islandsAfter"`
+	Migrations     []*Migration `json:"migrations"`
+	Pinned         []*PinnedPod `json:"pinned,omitempty"`
+}
+
+// DefragPlan proposes the pod migrations which restore the most islands of
+// free GPUs with the fewest moves. The moved pods keep at least their link
+// quality, and the lower priority pods are moved first. Nothing is evicted.
+func (cache *SchedulerCache) DefragPlan(opts *DefragOptions) *DefragPlan {
+	p := newDefragPlanner(cache.Nodes(), opts, cache.GetScoringConfig())
+	plan := &DefragPlan{
+		IslandSize:     opts.IslandSize,
+		MinLinkQuality: opts.MinLinkQuality,
+		Migrations:     []*Migration{},
+		Pinned:         p.pinned,
+	}
+	plan.IslandsBefore = p.totalIslands()
+
+	for opts.MaxMigrations <= 0 || len(plan.Migrations) < opts.MaxMigrations {
+		var best *defragCandidate
+		for _, name := range p.names {
+			c := p.evacuate(name, len(plan.Migrations))
+			if c != nil && c.better(best) {
+				best = c
+			}
+		}
+		if best == nil {
+			break
+		}
+		klog.V(2).Infof("Defrag: moving %d pods off node %s restores %d islands", len(best.migrations), best.migrations[0].From, best.gain)
+		p.apply(best)
+		plan.Migrations = append(plan.Migrations, best.migrations...)
+	}
+
+	plan.IslandsAfter = p.totalIslands()
+	return plan
+}
+
+type defragPod struct {
+	pod      *v1.Pod
+	node     string
+	uuids    []string
+	quality  int
+	priority int32
+	pdbs     []int
+}
+
+// defragNode is a copy of the schedulable GPUs of a node and their pods
+type defragNode struct {
+	name     string
+	resource string
+	devs     []*Device
+	scores   map[string]int
+	used     map[string]types.UID
+}
+
+func (n *defragNode) pairScore(a, b *Device) int {
+	return n.scores[pairKey(a.UUID, b.UUID)]
+}
+
+func (n *defragNode) free() []*Device {
+	var free []*Device
+	for _, d := range n.devs {
+		if _, ok := n.used[d.UUID]; !ok {
+			free = append(free, d)
+		}
+	}
+	return free
+}
+
+func (n *defragNode) clone() *defragNode {
+	c := *n
+	c.used = make(map[string]types.UID, len(n.used))
+	for uuid, uid := range n.used {
+		c.used[uuid] = uid
+	}
+	return &c
+}
+
+type defragPlanner struct {
+	opts   *DefragOptions
+	names  []string
+	nodes  map[string]*defragNode
+	pods   map[string][]*defragPod
+	moved  map[types.UID]bool
+	budget []int32
+	pinned []*PinnedPod
+	// islands memoizes the islands of a node by its used GPUs
+	islands map[string]int
+}
+
+func newDefragPlanner(nodes []*NodeInfo, opts *DefragOptions, cfg *ScoringConfig) *defragPlanner {
+	p := &defragPlanner{
+		opts:    opts,
+		nodes:   make(map[string]*defragNode, len(nodes)),
+		pods:    make(map[string][]*defragPod, len(nodes)),
+		moved:   map[types.UID]bool{},
+		budget:  make([]int32, len(opts.PDBs)),
+		islands: map[string]int{},
+	}
+	for i, pdb := range opts.PDBs {
+		p.budget[i] = pdb.Status.PodDisruptionsAllowed
+	}
+	for _, n := range nodes {
+		p.addNode(n, cfg)
+	}
+	return p
+}
+
+func (p *defragPlanner) addNode(n *NodeInfo, cfg *ScoringConfig) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	pairScore := n.pairScorer(cfg)
+
+	dn := &defragNode{
+		name:     n.name,
+		resource: n.resource,
+		scores:   map[string]int{},
+		used:     map[string]types.UID{},
+	}
+	for _, d := range n.topology.GPUDevice {
+		if n.isSchedulable(d.UUID) {
+			dn.devs = append(dn.devs, d)
+		}
+	}
+	for i := range dn.devs {
+		for j := i + 1; j < len(dn.devs); j++ {
+			dn.scores[pairKey(dn.devs[i].UUID, dn.devs[j].UUID)] = pairScore(dn.devs[i], dn.devs[j])
+		}
+	}
+
+	byUID := map[types.UID]*defragPod{}
+	var pods []*defragPod
+	for uuid, pod := range n.devs {
+		dn.used[uuid] = pod.UID
+		dp, ok := byUID[pod.UID]
+		if !ok {
+			dp = &defragPod{pod: pod, node: n.name}
+			if pod.Spec.Priority != nil {
+				dp.priority = *pod.Spec.Priority
+			}
+			byUID[pod.UID] = dp
+			pods = append(pods, dp)
+		}
+		dp.uuids = append(dp.uuids, uuid)
+	}
+	for _, dp := range pods {
+		sort.Strings(dp.uuids)
+		devs := make([]*Device, 0, len(dp.uuids))
+		for _, uuid := range dp.uuids {
+			if d := n.getDevice(uuid); d != nil {
+				devs = append(devs, d)
+			}
+		}
+		dp.quality = averagePairScore(devs, pairScore)
+
+		if reason := p.pinReason(dp); reason != "" {
+			p.pinned = append(p.pinned, &PinnedPod{Namespace: dp.pod.Namespace, Name: dp.pod.Name, Node: n.name, Reason: reason})
+			continue
+		}
+		p.pods[n.name] = append(p.pods[n.name], dp)
+	}
+	// the lower priority and the smaller pods are moved first
+	sort.Slice(p.pods[n.name], func(i, j int) bool {
+		a, b := p.pods[n.name][i], p.pods[n.name][j]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if len(a.uuids) != len(b.uuids) {
+			return len(a.uuids) < len(b.uuids)
+		}
+		return a.pod.Namespace+"/"+a.pod.Name < b.pod.Namespace+"/"+b.pod.Name
+	})
+
+	p.nodes[n.name] = dn
+	p.names = append(p.names, n.name)
+}
+
+// pinReason tells why the pod can never be moved, it also records the
+// disruption budgets covering the pod
+func (p *defragPlanner) pinReason(dp *defragPod) string {
+	owner := metav1.GetControllerOf(dp.pod)
+	if owner == nil {
+		return "not managed by a controller"
+	}
+	if owner.Kind == "DaemonSet" {
+		return "managed by a daemon set"
+	}
+	if p.opts.MaxPriority != nil && dp.priority > *p.opts.MaxPriority {
+		return "priority above the limit"
+	}
+	for i, pdb := range p.opts.PDBs {
+		if pdb.Namespace != dp.pod.Namespace || pdb.Spec.Selector == nil ||
+			len(pdb.Spec.Selector.MatchLabels)+len(pdb.Spec.Selector.MatchExpressions) == 0 {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(dp.pod.Labels)) {
+			continue
+		}
+		if p.budget[i] <= 0 {
+			return "disruption budget " + pdb.Name + " allows no disruption"
+		}
+		dp.pdbs = append(dp.pdbs, i)
+	}
+	return ""
+}
+
+func (p *defragPlanner) nodeIslands(n *defragNode) int {
+	used := make([]string, 0, len(n.used))
+	for uuid := range n.used {
+		used = append(used, uuid)
+	}
+	sort.Strings(used)
+	key := n.name + "/" + strings.Join(used, ",")
+	if islands, ok := p.islands[key]; ok {
+		return islands
+	}
+	islands := countDisjointSets(n.free(), p.opts.IslandSize, p.opts.MinLinkQuality, n.pairScore)
+	p.islands[key] = islands
+	return islands
+}
+
+func (p *defragPlanner) totalIslands() int {
+	var total int
+	for _, name := range p.names {
+		total += p.nodeIslands(p.nodes[name])
+	}
+	return total
+}
+
+// defragCandidate moves pods off a node, the nodes it changes are copies
+type defragCandidate struct {
+	gain       int
+	priority   int64
+	changed    map[string]*defragNode
+	pods       []*defragPod
+	migrations []*Migration
+}
+
+// better prefers the most islands per migration, then the fewest
+// migrations and the lowest priorities
+func (c *defragCandidate) better(o *defragCandidate) bool {
+	if o == nil {
+		return true
+	}
+	if l, r := c.gain*len(o.migrations), o.gain*len(c.migrations); l != r {
+		return l > r
+	}
+	if len(c.migrations) != len(o.migrations) {
+		return len(c.migrations) < len(o.migrations)
+	}
+	return c.priority < o.priority
+}
+
+func (c *defragCandidate) node(p *defragPlanner, name string) *defragNode {
+	if n, ok := c.changed[name]; ok {
+		return n
+	}
+	n := p.nodes[name].clone()
+	c.changed[name] = n
+	return n
+}
+
+// evacuate moves the pods off the node, lowest priority first, until it has
+// one more island, and places them on the other nodes. It returns nil if it
+// doesn't restore any island overall.
+func (p *defragPlanner) evacuate(name string, planned int) *defragCandidate {
+	base := p.nodeIslands(p.nodes[name])
+	c := &defragCandidate{changed: map[string]*defragNode{}}
+	used := make([]int32, len(p.budget))
+
+	from := c.node(p, name)
+	restored := false
+	for _, dp := range p.pods[name] {
+		if p.moved[dp.pod.UID] {
+			continue
+		}
+		if p.opts.MaxMigrations > 0 && planned+len(c.pods) >= p.opts.MaxMigrations {
+			return nil
+		}
+		for _, i := range dp.pdbs {
+			if used[i]++; used[i] > p.budget[i] {
+				return nil
+			}
+		}
+		for _, uuid := range dp.uuids {
+			delete(from.used, uuid)
+		}
+		c.pods = append(c.pods, dp)
+		c.priority += int64(dp.priority)
+		if p.nodeIslands(from) > base {
+			restored = true
+			break
+		}
+	}
+	if !restored {
+		return nil
+	}
+
+	for _, dp := range c.pods {
+		m := p.place(c, dp)
+		if m == nil {
+			return nil
+		}
+		c.migrations = append(c.migrations, m)
+	}
+
+	for n, dn := range c.changed {
+		c.gain += p.nodeIslands(dn) - p.nodeIslands(p.nodes[n])
+	}
+	if c.gain <= 0 {
+		return nil
+	}
+	return c
+}
+
+// place chooses the node of the same resource which loses the fewest islands
+// by holding the pod, with at least the link quality the pod has now
+func (p *defragPlanner) place(c *defragCandidate, dp *defragPod) *Migration {
+	var (
+		best     *defragNode
+		bestDevs []*Device
+		bestLoss int
+		bestFree int
+	)
+	resource := p.nodes[dp.node].resource
+	for _, name := range p.names {
+		if name == dp.node || p.nodes[name].resource != resource {
+			continue
+		}
+		n := p.nodes[name]
+		if changed, ok := c.changed[name]; ok {
+			n = changed
+		}
+		free := n.free()
+		if len(free) < len(dp.uuids) {
+			continue
+		}
+		score := func(devs []*Device) int {
+			return averagePairScore(devs, n.pairScore)
+		}
+		devs, quality, err := selectSubset(free, nil, len(dp.uuids), score)
+		if err != nil || quality < dp.quality {
+			continue
+		}
+
+		after := n.clone()
+		for _, d := range devs {
+			after.used[d.UUID] = dp.pod.UID
+		}
+		loss := p.nodeIslands(n) - p.nodeIslands(after)
+		if best == nil || loss < bestLoss || (loss == bestLoss && len(free) < bestFree) {
+			best, bestDevs, bestLoss, bestFree = n, devs, loss, len(free)
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	to := c.node(p, best.name)
+	for _, d := range bestDevs {
+		to.used[d.UUID] = dp.pod.UID
+	}
+	return &Migration{
+		Namespace: dp.pod.Namespace,
+		Name:      dp.pod.Name,
+		UID:       dp.pod.UID,
+		Priority:  dp.priority,
+		From:      dp.node,
+		FromGPUs:  dp.uuids,
+		To:        best.name,
+		ToGPUs:    deviceUUIDs(bestDevs),
+	}
+}
+
+// apply commits the candidate to the planner state
+func (p *defragPlanner) apply(c *defragCandidate) {
+	for name, n := range c.changed {
+		p.nodes[name] = n
+	}
+	for _, dp := range c.pods {
+		p.moved[dp.pod.UID] = true
+		for _, i := range dp.pdbs {
+			p.budget[i]--
+		}
+	}
+}
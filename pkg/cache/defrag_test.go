@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// defragPodSpec is a pod of the defrag fixtures
+type defragPodSpec struct {
+	node     string
+	name     string
+	gpus     []int
+	priority int32
+	// owner is the kind of the controller, none if empty
+	owner string
+}
+
+func newDefragCache(nodes []string, pods []defragPodSpec) *SchedulerCache {
+	infos := map[string]*NodeInfo{}
+	var list []*NodeInfo
+	for _, name := range nodes {
+		infos[name] = newNamedTestNodeInfo(name, 8)
+		list = append(list, infos[name])
+	}
+	for _, spec := range pods {
+		pod := newTestPod(spec.name, infos[spec.node].resource, int64(len(spec.gpus)))
+		pod.Labels = map[string]string{"app": "train"}
+		pod.Spec.Priority = &spec.priority
+		if spec.owner != "" {
+			controller := true
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: spec.owner, Name: spec.name, Controller: &controller}}
+		}
+		useGPUsAt(infos[spec.node], pod, spec.gpus...)
+	}
+	return newTestCache(list...)
+}
+
+// useGPUsAt assigns the GPUs of the indexes of the node to the pod
+func useGPUsAt(n *NodeInfo, pod *v1.Pod, indexes ...int) {
+	pod = pod.DeepCopy()
+	pod.Spec.NodeName = n.name
+	var uuids []string
+	for _, i := range indexes {
+		uuid := n.topology.GPUDevice[i].UUID
+		uuids = append(uuids, uuid)
+		n.devs[uuid] = pod
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[n.resource] = strings.Join(uuids, ",")
+}
+
+func newTestPDB(name string, allowed int32) *policy.PodDisruptionBudget {
+	minAvailable := intstr.FromInt(1)
+	return &policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: policy.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "train"}},
+		},
+		Status: policy.PodDisruptionBudgetStatus{PodDisruptionsAllowed: allowed},
+	}
+}
+
+func TestDefragPlan(t *testing.T) {
+	maxPriority := int32(5)
+
+	tests := []struct {
+		name  string
+		nodes []string
+		pods  []defragPodSpec
+		opts  DefragOptions
+		// want are the migrations as name:from->to
+		want       []string
+		wantPinned []string
+		before     int
+		after      int
+	}{
+		{
+			name:  "lowest priority moves",
+			nodes: []string{"a", "b"},
+			pods: []defragPodSpec{
+				{node: "a", name: "low", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "b", name: "high", gpus: []int{0, 1}, priority: 10, owner: "ReplicaSet"},
+			},
+			want:   []string{"low:a->b"},
+			before: 2,
+			after:  3,
+		},
+		{
+			name:  "priority cap",
+			nodes: []string{"a", "b"},
+			pods: []defragPodSpec{
+				{node: "a", name: "high", gpus: []int{0}, priority: 10, owner: "ReplicaSet"},
+				{node: "b", name: "low", gpus: []int{0, 1}, owner: "ReplicaSet"},
+			},
+			opts:       DefragOptions{MaxPriority: &maxPriority},
+			want:       []string{"low:b->a"},
+			wantPinned: []string{"high:priority above the limit"},
+			before:     2,
+			after:      3,
+		},
+		{
+			name:  "controller-less and daemon set pods are pinned",
+			nodes: []string{"a", "b"},
+			pods: []defragPodSpec{
+				{node: "a", name: "bare", gpus: []int{0}},
+				{node: "b", name: "agent", gpus: []int{0}, owner: "DaemonSet"},
+			},
+			wantPinned: []string{"bare:not managed by a controller", "agent:managed by a daemon set"},
+			before:     2,
+			after:      2,
+		},
+		{
+			name:  "exhausted disruption budget",
+			nodes: []string{"a", "b"},
+			pods: []defragPodSpec{
+				{node: "a", name: "train", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "b", name: "other", gpus: []int{0}, owner: "ReplicaSet"},
+			},
+			opts:       DefragOptions{PDBs: []*policy.PodDisruptionBudget{newTestPDB("train", 0)}},
+			wantPinned: []string{"train:disruption budget train allows no disruption", "other:disruption budget train allows no disruption"},
+			before:     2,
+			after:      2,
+		},
+		{
+			name:  "disruption budget used across the migrations",
+			nodes: []string{"a", "b", "c"},
+			pods: []defragPodSpec{
+				{node: "a", name: "p1", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "b", name: "p2", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "c", name: "p3", gpus: []int{0}, owner: "ReplicaSet"},
+			},
+			opts:   DefragOptions{PDBs: []*policy.PodDisruptionBudget{newTestPDB("train", 1)}},
+			want:   []string{"p1:a->b"},
+			before: 3,
+			after:  4,
+		},
+		{
+			name:  "without a budget",
+			nodes: []string{"a", "b", "c"},
+			pods: []defragPodSpec{
+				{node: "a", name: "p1", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "b", name: "p2", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "c", name: "p3", gpus: []int{0}, owner: "ReplicaSet"},
+			},
+			want:   []string{"p1:a->b", "p3:c->b"},
+			before: 3,
+			after:  5,
+		},
+		{
+			name:  "most islands per migration first",
+			nodes: []string{"a", "b", "c"},
+			pods: []defragPodSpec{
+				{node: "a", name: "p1", gpus: []int{0}, owner: "ReplicaSet"},
+				{node: "a", name: "p2", gpus: []int{4}, owner: "ReplicaSet"},
+				{node: "b", name: "p3", gpus: []int{0}, owner: "ReplicaSet"},
+			},
+			want:   []string{"p3:b->a"},
+			before: 4,
+			after:  5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newDefragCache(test.nodes, test.pods)
+			opts := test.opts
+			opts.IslandSize = 4
+			plan := c.DefragPlan(&opts)
+
+			var got []string
+			for _, m := range plan.Migrations {
+				got = append(got, fmt.Sprintf("%s:%s->%s", m.Name, m.From, m.To))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got migrations %v, want %v", got, test.want)
+			}
+			var pinned []string
+			for _, p := range plan.Pinned {
+				pinned = append(pinned, p.Name+":"+p.Reason)
+			}
+			if !reflect.DeepEqual(pinned, test.wantPinned) {
+				t.Errorf("got pinned %v, want %v", pinned, test.wantPinned)
+			}
+			if plan.IslandsBefore != test.before || plan.IslandsAfter != test.after {
+				t.Errorf("got islands %d -> %d, want %d -> %d", plan.IslandsBefore, plan.IslandsAfter, test.before, test.after)
+			}
+		})
+	}
+}
+
+func TestDefragPlanKeepsResource(t *testing.T) {
+	c := newDefragCache([]string{"a", "b"}, []defragPodSpec{
+		{node: "a", name: "p1", gpus: []int{0}, owner: "ReplicaSet"},
+		{node: "b", name: "p2", gpus: []int{0}, owner: "ReplicaSet"},
+	})
+	b, err := c.GetNodeInfo("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.resource = "amd.com/gpu-topo"
+
+	plan := c.DefragPlan(&DefragOptions{IslandSize: 4})
+	if len(plan.Migrations) != 0 {
+		t.Errorf("got migrations %+v, want none between the GPUs of different resources", plan.Migrations)
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 // Topology defined the whole topology for the node
 type Topology struct {
+	APIVersion string           `json:"apiVersion,omitempty"`
 	SystemInfo HostSystemInfo   `json:"systemInfo"`
 	CPUInfo    HostCPUInfo      `json:"cpuInfo"`
 	CPUPkg     []HostCPUPackage `json:"cpuPkg"`
@@ -9,6 +10,7 @@ type Topology struct {
 	NumaInfo   *HostNumaInfo    `json:"numaInfo,omitempty"`
 	SmcPresent *bool            `json:"smcPresent"`
 	GPUDevice  []*Device        `json:"gpuDevice,omitempty"`
+	NICs       []NIC            `json:"nics,omitempty"`
 }
 
 // HostSystemInfo define system info
@@ -25,20 +27,20 @@ type HostSystemInfo struct {
 
 // HostCPUInfo define CPU info
 type HostCPUInfo struct {
-	NumCPUPackages int16
-	NumCPUCores    int16
-	NumCPUThreads  int16
-	Hz             int64
+	NumCPUPackages int16 `json:"numCPUPackages"`
+	NumCPUCores    int16 `json:"numCPUCores"`
+	NumCPUThreads  int16 `json:"numCPUThreads"`
+	Hz             int64 `json:"hz"`
 }
 
 // HostCPUPackage define CPU package
 type HostCPUPackage struct {
-	Index        int16
-	Vendor       string
-	FamilyNumber int16
-	ModelNumber  int16
-	Model        string
-	Stepping     int16
+	Index        int16  `json:"index"`
+	Vendor       string `json:"vendor"`
+	FamilyNumber int16  `json:"familyNumber"`
+	ModelNumber  int16  `json:"modelNumber"`
+	Model        string `json:"model"`
+	Stepping     int16  `json:"stepping"`
 }
 
 // HostCPUCacheType define CPU cache type
@@ -82,6 +84,8 @@ type HostNumaInfo struct {
 	Type     string         `json:"type"`
 	NumNodes int32          `json:"numNodes"`
 	NumaNode []HostNumaNode `json:"numaNode,omitempty"`
+	// Distances[i][j] is the distance from NumaNode[i] to NumaNode[j]
+	Distances [][]int32 `json:"distances,omitempty"`
 }
 
 // HostNumaNode defined numa node spec
@@ -91,3 +95,14 @@ type HostNumaNode struct {
 	MemoryRangeBegin  int64   `json:"memoryRangeBegin"`
 	MemoryRangeLength int64   `json:"memoryRangeLength"`
 }
+
+// NIC defined the network interface of the node
+type NIC struct {
+	Name     string  `json:"name"`
+	PCI      PCIInfo `json:"pci"`
+	NumaNode *int32  `json:"numaNode,omitempty"`
+	// Speed is the link speed in Mbps
+	Speed *uint `json:"speed,omitempty"`
+	// GPULinks[i] is the P2P link between the NIC and GPUDevice[i]
+	GPULinks []P2PLinkType `json:"gpuLinks,omitempty"`
+}
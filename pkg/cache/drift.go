@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/metrics"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	// EventReasonDegradedLink is recorded on the node whose GPU links are worse than expected
+	EventReasonDegradedLink = "DegradedLink"
+	// EventReasonLinkRestored is recorded on the node whose degraded GPU links are restored
+	EventReasonLinkRestored = "LinkRestored"
+)
+
+var degradedLinksGauge = metrics.NewGaugeVec("gpu_topo_degraded_links",
+	"The number of GPU pairs whose reported link is worse than expected.", "node")
+
+// DegradedLink is a GPU pair whose reported link is worse than expected
+type DegradedLink struct {
+	UUIDs [2]string `json:"uuids"`
+	// Expected and Reported are decoded from the P2PLinkType numbers of
+	// the older snapshots too
+	Expected LinkDescriptor `json:"expected"`
+	Reported LinkDescriptor `json:"reported"`
+}
+
+func (l DegradedLink) String() string {
+	return fmt.Sprintf("%s-%s: %s instead of %s", l.UUIDs[0], l.UUIDs[1], l.Reported, l.Expected)
+}
+
+// DegradationHandler is notified when the degraded links of a node change
+type DegradationHandler func(node *v1.Node, links []DegradedLink)
+
+// DetectDegradedLinks compares the links of the GPU pairs in reported with
+// the same pairs in expected, the devices are matched by their UUIDs.
+func DetectDegradedLinks(expected, reported *Topology) []DegradedLink {
+	byUUID := make(map[string]*Device, len(expected.GPUDevice))
+	for _, d := range expected.GPUDevice {
+		byUUID[d.UUID] = d
+	}
+
+	var links []DegradedLink
+	for i, a := range reported.GPUDevice {
+		for _, b := range reported.GPUDevice[i+1:] {
+			ea, eb := byUUID[a.UUID], byUUID[b.UUID]
+			if ea == nil || eb == nil {
+				continue
+			}
+			want, got := linkBetween(ea, eb), linkBetween(a, b)
+			if linkDegraded(want, got) {
+				links = append(links, DegradedLink{
+					UUIDs:    [2]string{a.UUID, b.UUID},
+					Expected: want,
+					Reported: got,
+				})
+			}
+		}
+	}
+	return links
+}
+
+// linkDegraded checks the reported link is worse than the expected one. A
+// direct link is degraded if it's lost, or has fewer links or less
+// bandwidth, a PCIe link if its path is longer.
+func linkDegraded(want, got LinkDescriptor) bool {
+	switch {
+	case !want.Known():
+		return false
+	case !got.Known():
+		return true
+	case want.fabric():
+		return got.Kind != want.Kind || got.Count < want.Count ||
+			(want.Bandwidth > 0 && got.Bandwidth < want.Bandwidth)
+	case got.fabric():
+		return false
+	}
+	return linkKindRanks[got.Kind] < linkKindRanks[want.Kind]
+}
+
+// betterTopology checks some links of t are better than in baseline and
+// none is worse, the devices should be the same
+func betterTopology(t, baseline *Topology) bool {
+	return len(DetectDegradedLinks(t, baseline)) > 0 && len(DetectDegradedLinks(baseline, t)) == 0
+}
+
+// sameDevices checks the two topologies have the same GPUs
+func sameDevices(a, b *Topology) bool {
+	if len(a.GPUDevice) != len(b.GPUDevice) {
+		return false
+	}
+	uuids := make(map[string]bool, len(a.GPUDevice))
+	for _, d := range a.GPUDevice {
+		uuids[d.UUID] = true
+	}
+	for _, d := range b.GPUDevice {
+		if !uuids[d.UUID] {
+			return false
+		}
+	}
+	return true
+}
+
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// expectedTopology returns the topology expanded from the template of the
+// reported model, nil if there is no template matching the devices. The
+// template may use the link types of the resource.
+func (cache *SchedulerCache) expectedTopology(resource string, t *Topology) *Topology {
+	tmpl, ok := cache.templates.Get(t.SystemInfo.Model)
+	if !ok || len(tmpl.LinkMatrix) != len(t.GPUDevice) {
+		return nil
+	}
+	var linkTypes map[string]string
+	if r, ok := utils.GetResource(resource); ok {
+		linkTypes = r.LinkTypes
+	}
+	expected, err := tmpl.expand(&TemplateRef{Model: tmpl.Model, UUIDs: deviceUUIDs(t.GPUDevice)}, linkTypes)
+	if err != nil {
+		klog.Warningf("Failed to expand the template of model %s: %v", tmpl.Model, err)
+		return nil
+	}
+	return expected
+}
+
+func (cache *SchedulerCache) reportDegradedLinks(node *v1.Node, links []DegradedLink, changed bool) {
+	degradedLinksGauge.Set(float64(len(links)), node.Name)
+	if !changed {
+		return
+	}
+
+	if len(links) > 0 {
+		msgs := make([]string, 0, len(links))
+		for _, l := range links {
+			msgs = append(msgs, l.String())
+		}
+		klog.Warningf("Node %s has degraded GPU links: %s", node.Name, strings.Join(msgs, ", "))
+		cache.recordEvent(node, v1.EventTypeWarning, EventReasonDegradedLink, "Degraded GPU links: %s", strings.Join(msgs, ", "))
+	} else {
+		klog.Infof("Node %s's GPU links are restored", node.Name)
+		cache.recordEvent(node, v1.EventTypeNormal, EventReasonLinkRestored, "The GPU links are restored")
+	}
+	cache.nLock.RLock()
+	handler := cache.degradationHandler
+	cache.nLock.RUnlock()
+	if handler != nil {
+		handler(node, links)
+	}
+}
+
+// DegradedLinks returns the degraded GPU links of the node
+func (n *NodeInfo) DegradedLinks() []DegradedLink {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	links := make([]DegradedLink, 0, len(n.degraded))
+	for _, l := range n.degraded {
+		links = append(links, l)
+	}
+	return links
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// CompressedTopologyPrefix flags the annotation which holds the gzip
+	// compressed and base64 encoded JSON of the topology
+	CompressedTopologyPrefix = "gzip+base64:"
+
+	// maxDecompressedTopologySize bounds the decompressed JSON of the
+	// annotation, the one of the 16-GPU topology of TestTopologyAnnotationSize
+	// is 22225 bytes
+	maxDecompressedTopologySize = 1 << 20
+)
+
+// EncodeTopologyAnnotation encodes the topology of any supported apiVersion
+// for the node annotation, the JSON is compressed if compress is true.
+func EncodeTopologyAnnotation(t interface{}, compress bool) (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	if !compress {
+		return string(data), nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return "", err
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+	return CompressedTopologyPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeTopologyAnnotation decodes the topology from the node annotation,
+// both the plain and the compressed JSON are accepted.
+func DecodeTopologyAnnotation(val string) (*Topology, error) {
+	if !strings.HasPrefix(val, CompressedTopologyPrefix) {
+		return DecodeTopology([]byte(val))
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, CompressedTopologyPrefix))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(zr, maxDecompressedTopologySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedTopologySize {
+		return nil, fmt.Errorf("the decompressed topology is larger than %d bytes", maxDecompressedTopologySize)
+	}
+	return DecodeTopology(data)
+}
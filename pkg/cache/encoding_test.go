@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// syntheticTopology is a topology of the GPUs on boards of 8, with NVLinks
+// on the same board and PCIe across the boards
+func syntheticTopology(gpus int) *Topology {
+	model := "Tesla V100-SXM3-32GB"
+	power := uint(350)
+	memory := uint64(32510)
+	bandwidth := uint(15760)
+
+	t := &Topology{
+		SystemInfo: HostSystemInfo{Vendor: "NVIDIA", Model: "DGX-2"},
+		CPUInfo:    HostCPUInfo{NumCPUCores: 48, NumCPUThreads: 96},
+		MemorySize: 1 << 40,
+	}
+	for i := 0; i < gpus; i++ {
+		affinity := uint(i / (gpus / 2))
+		t.GPUDevice = append(t.GPUDevice, &Device{
+			UUID:        fmt.Sprintf("GPU-%08x-1c2d-4e5f-8a9b-0c1d2e3f4a5b", i),
+			Path:        fmt.Sprintf("/dev/nvidia%d", i),
+			Model:       &model,
+			Power:       &power,
+			Memory:      &memory,
+			CPUAffinity: &affinity,
+			PCI:         PCIInfo{BusID: fmt.Sprintf("00000000:%02X:00.0", 0x30+i), Bandwidth: &bandwidth},
+		})
+	}
+	for i, d := range t.GPUDevice {
+		for j, peer := range t.GPUDevice {
+			if i == j {
+				continue
+			}
+			link := LinkDescriptor{Kind: LinkKindPCIeCrossCPU}
+			if i/8 == j/8 {
+				link = NVLinks(6)
+			}
+			d.Topology = append(d.Topology, P2PLink{BusID: peer.PCI.BusID, Link: link})
+		}
+	}
+	return t
+}
+
+func benchmarkDecodeTopologyAnnotation(b *testing.B, compress bool) {
+	val, err := EncodeTopologyAnnotation(syntheticTopology(16), compress)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeTopologyAnnotation(val); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(val)), "annotation-bytes")
+}
+
+func BenchmarkDecodeTopologyAnnotationJSON(b *testing.B) {
+	benchmarkDecodeTopologyAnnotation(b, false)
+}
+
+func BenchmarkDecodeTopologyAnnotationGzip(b *testing.B) {
+	benchmarkDecodeTopologyAnnotation(b, true)
+}
+
+func TestTopologyAnnotationSize(t *testing.T) {
+	for _, gpus := range []int{8, 16} {
+		topo := syntheticTopology(gpus)
+		plain, err := EncodeTopologyAnnotation(topo, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed, err := EncodeTopologyAnnotation(topo, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%d GPUs: JSON %d bytes, gzip+base64 %d bytes", gpus, len(plain), len(compressed))
+
+		decoded, err := DecodeTopologyAnnotation(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded.GPUDevice) != gpus {
+			t.Errorf("decoded %d GPUs, want %d", len(decoded.GPUDevice), gpus)
+		}
+	}
+}
+
+func TestDecodeTopologyAnnotationTooLarge(t *testing.T) {
+	val, err := EncodeTopologyAnnotation(strings.Repeat(" ", maxDecompressedTopologySize), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeTopologyAnnotation(val); err == nil {
+		t.Errorf("decoded a topology larger than %d bytes", maxDecompressedTopologySize)
+	}
+}
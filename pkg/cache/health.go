@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/metrics"
+)
+
+const (
+	// EventReasonUnhealthyGPU is recorded on the node when its GPUs become unhealthy
+	EventReasonUnhealthyGPU = "UnhealthyGPU"
+)
+
+var unhealthyDevicesGauge = metrics.NewGaugeVec("gpu_topo_unhealthy_devices",
+	"The number of GPUs excluded from scheduling by the health rules.", "node")
+
+// HealthRules decide whether a GPU is schedulable from its DeviceStatus
+type HealthRules struct {
+	// MaxECCErrors is the largest number of uncorrectable ECC errors of a healthy GPU
+	MaxECCErrors uint64 `json:"maxECCErrors"`
+	// MaxTemperature is the highest temperature of a healthy GPU, 0 disables the rule
+	MaxTemperature uint `json:"maxTemperature,omitempty"`
+	// ThrottleReasons make the GPU unhealthy when they're reported in
+	// ThrottlePersistence consecutive statuses
+	ThrottleReasons     []ThrottleReason `json:"throttleReasons,omitempty"`
+	ThrottlePersistence int              `json:"throttlePersistence"`
+}
+
+// DefaultHealthRules exclude the GPUs with uncorrectable ECC errors or
+// a persistent hardware thermal slowdown
+func DefaultHealthRules() *HealthRules {
+	return &HealthRules{
+		MaxECCErrors:        0,
+		ThrottleReasons:     []ThrottleReason{ThrottleReasonHwThermalSlowdown},
+		ThrottlePersistence: 3,
+	}
+}
+
+func (r *HealthRules) isThrottled(s *DeviceStatus) bool {
+	for _, reason := range r.ThrottleReasons {
+		if s.Throttle == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why the device is unhealthy, or empty if it's healthy.
+// throttled is the number of consecutive statuses with the throttle reasons.
+func (r *HealthRules) check(s *DeviceStatus, throttled int) string {
+	var ecc uint64
+	for _, c := range []*uint64{s.Memory.ECCErrors.L1Cache, s.Memory.ECCErrors.L2Cache, s.Memory.ECCErrors.Device} {
+		if c != nil {
+			ecc += *c
+		}
+	}
+	switch {
+	case ecc > r.MaxECCErrors:
+		return fmt.Sprintf("%d uncorrectable ECC errors", ecc)
+	case r.MaxTemperature > 0 && s.Temperature != nil && *s.Temperature > r.MaxTemperature:
+		return fmt.Sprintf("temperature %d exceeds %d", *s.Temperature, r.MaxTemperature)
+	case r.ThrottlePersistence > 0 && throttled >= r.ThrottlePersistence:
+		return fmt.Sprintf("throttled by %s in %d consecutive reports", s.Throttle, throttled)
+	}
+	return ""
+}
+
+// updateStatus stores the statuses of the devices and evaluates their health,
+// it returns the devices which become unhealthy.
+func (n *NodeInfo) updateStatus(status map[string]*DeviceStatus, rules *HealthRules) (newlyUnhealthy []string) {
+	n.rwmu.Lock()
+	defer n.rwmu.Unlock()
+
+	for uuid, s := range status {
+		if s == nil {
+			continue
+		}
+		n.status[uuid] = s
+		if rules.isThrottled(s) {
+			n.throttled[uuid]++
+		} else {
+			delete(n.throttled, uuid)
+		}
+
+		reason := rules.check(s, n.throttled[uuid])
+		_, wasUnhealthy := n.unhealthy[uuid]
+		switch {
+		case reason != "" && !wasUnhealthy:
+			newlyUnhealthy = append(newlyUnhealthy, fmt.Sprintf("%s (%s)", uuid, reason))
+			n.unhealthy[uuid] = reason
+		case reason != "":
+			n.unhealthy[uuid] = reason
+		case wasUnhealthy:
+			klog.Infof("GPU %s on node %s is healthy again", uuid, n.name)
+			delete(n.unhealthy, uuid)
+		}
+	}
+	sort.Strings(newlyUnhealthy)
+	return newlyUnhealthy
+}
+
+// isSchedulable checks the device is neither unhealthy nor cordoned, the
+// caller should hold the lock
+func (n *NodeInfo) isSchedulable(uuid string) bool {
+	_, unhealthy := n.unhealthy[uuid]
+	return !unhealthy && !n.cordoned[uuid]
+}
+
+// SetHealthRules replaces the rules evaluated on the next device statuses
+func (cache *SchedulerCache) SetHealthRules(rules *HealthRules) {
+	cache.nLock.Lock()
+	defer cache.nLock.Unlock()
+	cache.healthRules = rules
+}
+
+// UpdateDeviceStatus stores the statuses reported for the GPUs of the node
+// and excludes the unhealthy ones from scheduling
+func (cache *SchedulerCache) UpdateDeviceStatus(name string, status map[string]*DeviceStatus) error {
+	n, err := cache.GetNodeInfo(name)
+	if err != nil {
+		return err
+	}
+
+	cache.nLock.RLock()
+	rules := cache.healthRules
+	cache.nLock.RUnlock()
+
+	newlyUnhealthy := n.updateStatus(status, rules)
+
+	n.rwmu.RLock()
+	unhealthyDevicesGauge.Set(float64(len(n.unhealthy)), name)
+	n.rwmu.RUnlock()
+
+	if len(newlyUnhealthy) > 0 {
+		msg := strings.Join(newlyUnhealthy, ", ")
+		klog.Warningf("GPUs on node %s become unhealthy: %s", name, msg)
+		cache.recordEvent(n.GetNode(), v1.EventTypeWarning, EventReasonUnhealthyGPU, "GPUs are excluded from scheduling: %s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"testing"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+func uintPtr(v uint) *uint       { return &v }
+
+func TestHealthRulesCheck(t *testing.T) {
+	rules := &HealthRules{
+		MaxECCErrors:        1,
+		MaxTemperature:      85,
+		ThrottleReasons:     []ThrottleReason{ThrottleReasonHwThermalSlowdown},
+		ThrottlePersistence: 3,
+	}
+	tests := []struct {
+		name      string
+		status    DeviceStatus
+		throttled int
+		unhealthy bool
+	}{
+		{"no status", DeviceStatus{}, 0, false},
+		{"ECC errors at the limit", DeviceStatus{Memory: MemoryInfo{ECCErrors: ECCErrorsInfo{Device: uint64Ptr(1)}}}, 0, false},
+		{"ECC errors summed over the limit", DeviceStatus{Memory: MemoryInfo{ECCErrors: ECCErrorsInfo{L1Cache: uint64Ptr(1), L2Cache: uint64Ptr(1)}}}, 0, true},
+		{"temperature at the limit", DeviceStatus{Temperature: uintPtr(85)}, 0, false},
+		{"temperature over the limit", DeviceStatus{Temperature: uintPtr(86)}, 0, true},
+		{"throttled shortly", DeviceStatus{Throttle: ThrottleReasonHwThermalSlowdown}, 2, false},
+		{"throttled persistently", DeviceStatus{Throttle: ThrottleReasonHwThermalSlowdown}, 3, true},
+	}
+	for _, test := range tests {
+		reason := rules.check(&test.status, test.throttled)
+		if (reason != "") != test.unhealthy {
+			t.Errorf("%s: got reason %q, want unhealthy %v", test.name, reason, test.unhealthy)
+		}
+	}
+
+	// 0 disables the temperature rule
+	rules.MaxTemperature = 0
+	if reason := rules.check(&DeviceStatus{Temperature: uintPtr(120)}, 0); reason != "" {
+		t.Errorf("the disabled temperature rule reported %q", reason)
+	}
+}
+
+func TestUpdateStatusThrottlePersistence(t *testing.T) {
+	n := newTestNodeInfo(2)
+	uuid := n.topology.GPUDevice[0].UUID
+	rules := DefaultHealthRules()
+	throttled := map[string]*DeviceStatus{uuid: {Throttle: ThrottleReasonHwThermalSlowdown}}
+	healthy := map[string]*DeviceStatus{uuid: {}}
+
+	for i := 1; i < rules.ThrottlePersistence; i++ {
+		if unhealthy := n.updateStatus(throttled, rules); len(unhealthy) > 0 {
+			t.Fatalf("unhealthy after %d throttled reports: %v", i, unhealthy)
+		}
+	}
+	// a report without the reason resets the count
+	n.updateStatus(healthy, rules)
+	n.updateStatus(throttled, rules)
+	if !n.isSchedulable(uuid) {
+		t.Fatalf("unhealthy after the count was reset")
+	}
+	for i := 1; i < rules.ThrottlePersistence; i++ {
+		n.updateStatus(throttled, rules)
+	}
+	if n.isSchedulable(uuid) {
+		t.Errorf("schedulable after %d throttled reports", rules.ThrottlePersistence)
+	}
+	n.updateStatus(healthy, rules)
+	if !n.isSchedulable(uuid) {
+		t.Errorf("unschedulable after a healthy report")
+	}
+}
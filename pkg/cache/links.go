@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LinkKind is the vendor-neutral kind of the P2P link between two GPUs
+type LinkKind string
+
+const (
+	// LinkKindUnknown is the link of a device to itself or an unknown link
+	LinkKindUnknown LinkKind = ""
+	// LinkKindPCIeCrossCPU traverses the interconnect between the CPU sockets
+	LinkKindPCIeCrossCPU LinkKind = "pcie-cross-cpu"
+	// LinkKindPCIeSameCPU traverses the host bridges of a CPU socket
+	LinkKindPCIeSameCPU LinkKind = "pcie-same-cpu"
+	// LinkKindPCIeHostBridge traverses a PCIe host bridge
+	LinkKindPCIeHostBridge LinkKind = "pcie-host-bridge"
+	// LinkKindPCIeMultiSwitch traverses several PCIe switches
+	LinkKindPCIeMultiSwitch LinkKind = "pcie-multi-switch"
+	// LinkKindPCIeSingleSwitch traverses a single PCIe switch
+	LinkKindPCIeSingleSwitch LinkKind = "pcie-single-switch"
+	// LinkKindBoard links the GPUs on the same board
+	LinkKindBoard LinkKind = "board"
+	// LinkKindNVLink is the NVIDIA NVLink
+	LinkKindNVLink LinkKind = "nvlink"
+	// LinkKindXGMI is the AMD xGMI, a.k.a. Infinity Fabric
+	LinkKindXGMI LinkKind = "xgmi"
+)
+
+const (
+	// NVLinkBandwidth is the nominal unidirectional bandwidth of an NVLink in GB/s
+	NVLinkBandwidth = 25
+	// XGMIBandwidth is the nominal unidirectional bandwidth of an xGMI link in GB/s
+	XGMIBandwidth = 50
+)
+
+// linkKindKeys are the abbreviations of the link kinds without a count, the
+// ones of `nvidia-smi topo -m` but BOARD which it doesn't report
+var linkKindKeys = map[LinkKind]string{
+	LinkKindPCIeCrossCPU:     "SYS",
+	LinkKindPCIeSameCPU:      "NODE",
+	LinkKindPCIeHostBridge:   "PHB",
+	LinkKindPCIeMultiSwitch:  "PXB",
+	LinkKindPCIeSingleSwitch: "PIX",
+	LinkKindBoard:            "BOARD",
+}
+
+// linkKindRanks order the PCIe link kinds by their distance
+var linkKindRanks = map[LinkKind]int{
+	LinkKindPCIeCrossCPU:     1,
+	LinkKindPCIeSameCPU:      2,
+	LinkKindPCIeHostBridge:   3,
+	LinkKindPCIeMultiSwitch:  4,
+	LinkKindPCIeSingleSwitch: 5,
+	LinkKindBoard:            6,
+}
+
+// LinkDescriptor describes the P2P link between two GPUs independently of
+// the vendor. It's decoded from the legacy P2PLinkType number too.
+type LinkDescriptor struct {
+	Kind LinkKind `json:"kind,omitempty"`
+	// Count is the number of the links, e.g. the NVLinks, 0 for PCIe
+	Count int `json:"count,omitempty"`
+	// Bandwidth is the nominal unidirectional bandwidth in GB/s, 0 if unknown
+	Bandwidth float64 `json:"bandwidth,omitempty"`
+}
+
+// Descriptor maps the NVIDIA link type onto the link descriptor
+func (t P2PLinkType) Descriptor() LinkDescriptor {
+	switch t {
+	case P2PLinkCrossCPU:
+		return LinkDescriptor{Kind: LinkKindPCIeCrossCPU}
+	case P2PLinkSameCPU:
+		return LinkDescriptor{Kind: LinkKindPCIeSameCPU}
+	case P2PLinkHostBridge:
+		return LinkDescriptor{Kind: LinkKindPCIeHostBridge}
+	case P2PLinkMultiSwitch:
+		return LinkDescriptor{Kind: LinkKindPCIeMultiSwitch}
+	case P2PLinkSingleSwitch:
+		return LinkDescriptor{Kind: LinkKindPCIeSingleSwitch}
+	case P2PLinkSameBoard:
+		return LinkDescriptor{Kind: LinkKindBoard}
+	case SingleNVLINKLink, TwoNVLINKLinks, ThreeNVLINKLinks, FourNVLINKLinks, FiveNVLINKLinks, SixNVLINKLinks:
+		return NVLinks(int(t-SingleNVLINKLink) + 1)
+	}
+	return LinkDescriptor{}
+}
+
+// NVLinks describes count NVLinks of the nominal bandwidth
+func NVLinks(count int) LinkDescriptor {
+	return LinkDescriptor{Kind: LinkKindNVLink, Count: count, Bandwidth: float64(count * NVLinkBandwidth)}
+}
+
+// XGMILinks describes count xGMI links of the nominal bandwidth
+func XGMILinks(count int) LinkDescriptor {
+	return LinkDescriptor{Kind: LinkKindXGMI, Count: count, Bandwidth: float64(count * XGMIBandwidth)}
+}
+
+// ParseLinkDescriptor parses the link abbreviation of `nvidia-smi topo -m`,
+// BOARD, NV<n> or XGMI<n>, "X" is the unknown link of a device to itself
+func ParseLinkDescriptor(s string) (LinkDescriptor, error) {
+	if s == "X" {
+		return LinkDescriptor{}, nil
+	}
+	for kind, key := range linkKindKeys {
+		if s == key {
+			return LinkDescriptor{Kind: kind}, nil
+		}
+	}
+
+	var count int
+	switch {
+	case strings.HasPrefix(s, "NV"):
+		if _, err := fmt.Sscanf(s, "NV%d", &count); err == nil && count > 0 {
+			return NVLinks(count), nil
+		}
+	case strings.HasPrefix(s, "XGMI"):
+		if _, err := fmt.Sscanf(s, "XGMI%d", &count); err == nil && count > 0 {
+			return XGMILinks(count), nil
+		}
+	}
+	return LinkDescriptor{}, ErrUnsupportedP2PLink
+}
+
+// Key is the abbreviation of the link, the key of the score table
+func (d LinkDescriptor) Key() string {
+	switch d.Kind {
+	case LinkKindUnknown:
+		return "X"
+	case LinkKindNVLink:
+		return fmt.Sprintf("NV%d", d.Count)
+	case LinkKindXGMI:
+		return fmt.Sprintf("XGMI%d", d.Count)
+	}
+	return linkKindKeys[d.Kind]
+}
+
+// Known checks the link is of a supported kind
+func (d LinkDescriptor) Known() bool {
+	switch d.Kind {
+	case LinkKindUnknown:
+		return false
+	case LinkKindNVLink, LinkKindXGMI:
+		return d.Count > 0
+	}
+	_, ok := linkKindKeys[d.Kind]
+	return ok
+}
+
+// fabric checks the link is a direct link between the GPUs, NVLink or xGMI
+func (d LinkDescriptor) fabric() bool {
+	return d.Kind == LinkKindNVLink || d.Kind == LinkKindXGMI
+}
+
+// nominalBandwidth is the bandwidth of the link in GB/s, the one of the
+// descriptor or of the links of its count. The PCIe links share the PCIe
+// bandwidth of the GPUs which isn't known here, they get the share of a PCIe
+// Gen3 x16 link their kind achieves.
+func (d LinkDescriptor) nominalBandwidth() float64 {
+	switch d.Kind {
+	case LinkKindNVLink:
+		if d.Bandwidth > 0 {
+			return d.Bandwidth
+		}
+		return float64(d.Count * NVLinkBandwidth)
+	case LinkKindXGMI:
+		if d.Bandwidth > 0 {
+			return d.Bandwidth
+		}
+		return float64(d.Count * XGMIBandwidth)
+	}
+	return defaultPCIeBandwidth * pcieEfficiency[d.Kind]
+}
+
+// Rank is the built-in score of the link, its nominal bandwidth rounded to
+// GB/s: 6 for SYS up to 16 for PIX and BOARD, 25 per NVLink and 50 per xGMI
+// link
+func (d LinkDescriptor) Rank() int {
+	return int(d.nominalBandwidth() + 0.5)
+}
+
+func (d LinkDescriptor) String() string {
+	switch d.Kind {
+	case LinkKindUnknown:
+		return "N/A"
+	case LinkKindNVLink, LinkKindXGMI:
+		if d.Bandwidth > 0 {
+			return fmt.Sprintf("%s (%g GB/s)", d.Key(), d.Bandwidth)
+		}
+	}
+	return d.Key()
+}
+
+// UnmarshalJSON decodes the link descriptor, or the P2PLinkType number of
+// the topologies annotated before the descriptors
+func (d *LinkDescriptor) UnmarshalJSON(data []byte) error {
+	var t P2PLinkType
+	if err := json.Unmarshal(data, &t); err == nil {
+		*d = t.Descriptor()
+		return nil
+	}
+	type descriptor LinkDescriptor
+	var out descriptor
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	*d = LinkDescriptor(out)
+	return nil
+}
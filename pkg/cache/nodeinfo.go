@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/klog"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
 
 	"github.com/gpucloud/node-topology-manager/pkg/utils"
 )
@@ -19,8 +21,26 @@ type NodeInfo struct {
 	name     string
 	node     *v1.Node
 	topology *Topology
+	// resource is the managed resource of the GPUs of the node
+	resource string
 	devs     map[string]*v1.Pod
 	rwmu     *sync.RWMutex
+
+	// baseline is the best report of the node's GPUs, it's compared with the
+	// reports of the node without a template. A node whose first report is
+	// already degraded is only detected once a better one is reported.
+	baseline *Topology
+	// degraded links keyed by pairKey
+	degraded map[string]DegradedLink
+
+	// status is the latest DeviceStatus of each GPU
+	status map[string]*DeviceStatus
+	// throttled counts the consecutive statuses with unhealthy throttle reasons
+	throttled map[string]int
+	// unhealthy GPUs and the reasons, they're excluded from scheduling
+	unhealthy map[string]string
+	// cordoned GPUs are taken out of service by the operators
+	cordoned map[string]bool
 }
 
 // NewNodeInfo Create Node Level
@@ -32,11 +52,17 @@ func NewNodeInfo(node *v1.Node) *NodeInfo {
 	topo := &Topology{}
 
 	return &NodeInfo{
-		name:     node.Name,
-		node:     node,
-		topology: topo,
-		devs:     devs,
-		rwmu:     new(sync.RWMutex),
+		name:      node.Name,
+		node:      node,
+		topology:  topo,
+		resource:  utils.DefaultResourceName(),
+		devs:      devs,
+		rwmu:      new(sync.RWMutex),
+		degraded:  map[string]DegradedLink{},
+		status:    map[string]*DeviceStatus{},
+		throttled: map[string]int{},
+		unhealthy: map[string]string{},
+		cordoned:  map[string]bool{},
 	}
 }
 
@@ -45,6 +71,13 @@ func (n *NodeInfo) GetName() string {
 	return n.name
 }
 
+// Resource is the managed resource of the GPUs of the node
+func (n *NodeInfo) Resource() string {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+	return n.resource
+}
+
 // GetNode get *v1.Node
 func (n *NodeInfo) GetNode() *v1.Node {
 	return n.node
@@ -78,13 +111,11 @@ func (n *NodeInfo) addOrUpdatePod(pod *v1.Pod) (added bool) {
 	klog.V(2).Infof("Pod %s in ns %s with the GPUs[%s] should be added to device map", pod.Name, pod.Namespace, uids)
 	if len(uids) > 0 {
 		for _, uid := range strings.Split(uids, ",") {
-			_, found := n.devs[uid]
-			if !found {
+			if n.getDevice(uid) == nil {
 				klog.Warningf("Pod %s in ns %s failed to find the GPU[%s] in node %s", pod.Name, pod.Namespace, uid, n.name)
-			} else {
-				n.devs[uid] = pod
-				added = true
 			}
+			n.devs[uid] = pod
+			added = true
 		}
 	} else {
 		klog.Warningf("Pod %s in ns %s is not set the GPU ID%v in node %s", pod.Name, pod.Namespace, uids, n.name)
@@ -92,30 +123,232 @@ func (n *NodeInfo) addOrUpdatePod(pod *v1.Pod) (added bool) {
 	return added
 }
 
+// setTopology replace the topology of the node's GPUs of the resource and
+// detect its degraded links against expected, or the baseline of the node if
+// expected is nil
+func (n *NodeInfo) setTopology(resource string, t, expected *Topology) (links []DegradedLink, changed bool) {
+	n.rwmu.Lock()
+	defer n.rwmu.Unlock()
+	n.topology = t
+	n.resource = resource
+
+	if expected == nil {
+		if n.baseline == nil || !sameDevices(n.baseline, t) || betterTopology(t, n.baseline) {
+			n.baseline = t
+		}
+		expected = n.baseline
+	}
+	links = DetectDegradedLinks(expected, t)
+
+	degraded := make(map[string]DegradedLink, len(links))
+	for _, l := range links {
+		key := pairKey(l.UUIDs[0], l.UUIDs[1])
+		if _, ok := n.degraded[key]; !ok {
+			changed = true
+		}
+		degraded[key] = l
+	}
+	changed = changed || len(degraded) != len(n.degraded)
+	n.degraded = degraded
+	return links, changed
+}
+
+// pairScorer scores the link of two devices in [0, maxSubsetScore] by the
+// score table of cfg for the node's resource, the degraded link is down-weighted as it's likely to
+// be unstable. The caller should hold the lock.
+func (n *NodeInfo) pairScorer(cfg *ScoringConfig) pairScoreFunc {
+	cfg = cfg.ForResource(n.resource)
+	scale := cfg.linkScale()
+	return func(a, b *Device) int {
+		score := scale(cfg.linkScore(linkBetween(a, b)))
+		if _, ok := n.degraded[pairKey(a.UUID, b.UUID)]; ok {
+			score /= 2
+		}
+		return score
+	}
+}
+
+// getDevice get the device by its UUID, the caller should hold the lock
+func (n *NodeInfo) getDevice(uuid string) *Device {
+	for _, d := range n.topology.GPUDevice {
+		if d.UUID == uuid {
+			return d
+		}
+	}
+	return nil
+}
+
+// freeDevices returns the schedulable devices which are not used by any pod,
+// the caller should hold the lock
+func (n *NodeInfo) freeDevices() []*Device {
+	var free []*Device
+	for _, d := range n.topology.GPUDevice {
+		if _, ok := n.devs[d.UUID]; ok {
+			// IN USE
+			continue
+		}
+		if !n.isSchedulable(d.UUID) {
+			continue
+		}
+		free = append(free, d)
+	}
+	return free
+}
+
 // MakeScore make the score for the pod on the node
-func (n *NodeInfo) MakeScore(pod *v1.Pod, gpuTopoNum int64) (int, error) {
-	// make sure we do the score for 2^n allocation
-	if gpuTopoNum&(gpuTopoNum-1) == 0 {
+func (n *NodeInfo) MakeScore(pod *v1.Pod, gpuTopoNum int64, cfg *ScoringConfig) (int, error) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	return n.makeScore(pod, gpuTopoNum, cfg)
+}
+
+// makeScore scores the node for the pod, the caller should hold the lock
+func (n *NodeInfo) makeScore(pod *v1.Pod, gpuTopoNum int64, cfg *ScoringConfig) (int, error) {
+	if gpuTopoNum <= 0 {
+		return 0, nil
+	}
+	free := n.freeDevices()
+	if int64(len(free)) < gpuTopoNum {
 		return 0, nil
 	}
 	if gpuTopoNum == 1 {
-		if len(n.devs)%2 == 1 {
-			return 10, nil
+		score := 1
+		if cfg.placementStrategy(pod) == utils.PlacementStrategySpread {
+			score = len(free) * schedulerapi.MaxPriority / len(n.topology.GPUDevice)
+		} else if len(n.devs)%2 == 1 {
+			score = schedulerapi.MaxPriority
+		}
+		if cfg.ThermalWeight > 0 {
+			_, thermal, err := n.bestFreeSubset(gpuTopoNum, cfg, utils.GetCommPattern(pod))
+			if err != nil {
+				return 0, err
+			}
+			score = (score*cfg.LinkWeight + thermal*schedulerapi.MaxPriority/maxSubsetScore*cfg.ThermalWeight) /
+				(cfg.LinkWeight + cfg.ThermalWeight)
 		}
-		return 1, nil
+		return score, nil
 	}
-	var score int
-	var num int
-	for i, d := range n.topology.GPUDevice {
-		if _, ok := n.devs[d.UUID]; ok {
-			// IN USE
+
+	_, score, err := n.bestFreeSubset(gpuTopoNum, cfg, utils.GetCommPattern(pod))
+	if err != nil {
+		return 0, err
+	}
+	return score * schedulerapi.MaxPriority / maxSubsetScore, nil
+}
+
+// bestFreeSubset chooses num free devices with the best score for the
+// communication pattern. The parameter server the devices are scored by is
+// the first one, AssumePod records it in the pod annotation. The caller
+// should hold the lock.
+func (n *NodeInfo) bestFreeSubset(num int64, cfg *ScoringConfig, pattern string) ([]*Device, int, error) {
+	devs, score, err := selectSubset(n.freeDevices(), nil, int(num), n.subsetScorer(cfg, pattern))
+	if err == nil && pattern == utils.CommPatternParameterServer && len(devs) > 1 {
+		server, _ := parameterServer(pairScores(devs, n.linkPairScorer(cfg)))
+		devs[0], devs[server] = devs[server], devs[0]
+	}
+	return devs, score, err
+}
+
+// Allocate chooses the GPUs of the pod on the node, they're the ones scored
+// by MakeScore
+func (n *NodeInfo) Allocate(pod *v1.Pod, gpuTopoNum int64, cfg *ScoringConfig) ([]string, error) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	pattern := utils.GetCommPattern(pod)
+	if value := pod.Annotations[utils.AnnotationCommPattern]; value != "" && pattern == "" {
+		klog.Warningf("Pod %s in ns %s has the unknown communication pattern %q, its GPUs are scored without it", pod.Name, pod.Namespace, value)
+	}
+	devs, _, err := n.bestFreeSubset(gpuTopoNum, cfg, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return deviceUUIDs(devs), nil
+}
+
+// LinkQuality is the link score in [0, 100] of the GPUs by the link scorer
+// of cfg
+func (n *NodeInfo) LinkQuality(uuids []string, cfg *ScoringConfig) int {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	devs := make([]*Device, 0, len(uuids))
+	for _, uuid := range uuids {
+		if d := n.getDevice(uuid); d != nil {
+			devs = append(devs, d)
+		}
+	}
+	return n.linkScorer(cfg, "")(devs)
+}
+
+// Fits checks the node has enough schedulable free GPUs of the resource for
+// the pod, the node whose topology is unknown is left to the resource fit of
+// the scheduler
+func (n *NodeInfo) Fits(resource string, gpuTopoNum int64) (bool, string) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	if gpuTopoNum <= 0 || len(n.topology.GPUDevice) == 0 {
+		return true, ""
+	}
+	if resource != n.resource {
+		return false, fmt.Sprintf("node %s has %s GPUs, %s requested", n.name, n.resource, resource)
+	}
+	if free := len(n.freeDevices()); int64(free) < gpuTopoNum {
+		return false, fmt.Sprintf("node %s has %d schedulable GPUs, %d requested", n.name, free, gpuTopoNum)
+	}
+	return true, ""
+}
+
+// PreferredAllocation choose size devices out of available, which contain
+// all the devices in mustInclude and have the best links between each other.
+// The devices in mustInclude must be available, schedulable and distinct.
+func (n *NodeInfo) PreferredAllocation(available, mustInclude []string, size int, cfg *ScoringConfig) ([]string, error) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	isAvailable := make(map[string]bool, len(available))
+	for _, uuid := range available {
+		isAvailable[uuid] = true
+	}
+	must := make([]*Device, 0, len(mustInclude))
+	included := make(map[string]bool, len(mustInclude))
+	for _, uuid := range mustInclude {
+		d := n.getDevice(uuid)
+		if d == nil {
+			return nil, ErrUnknownDevice
+		}
+		if included[uuid] {
+			return nil, ErrDuplicateDevice
+		}
+		if !isAvailable[uuid] || !n.isSchedulable(uuid) {
+			return nil, ErrUnavailableDevice
+		}
+		must = append(must, d)
+		included[uuid] = true
+	}
+
+	var candidates []*Device
+	for _, uuid := range available {
+		if included[uuid] {
 			continue
 		}
-		num++
-		for j := i + 1; j < len(d.Topology); j++ {
-			score += d.Topology[j].Link.Score()
+		included[uuid] = true
+		if d := n.getDevice(uuid); d != nil {
+			if !n.isSchedulable(d.UUID) {
+				klog.V(2).Infof("Device %s on node %s is not schedulable, skip", uuid, n.name)
+				continue
+			}
+			candidates = append(candidates, d)
+		} else {
+			klog.V(2).Infof("Device %s is not in the topology of node %s, skip", uuid, n.name)
 		}
 	}
 
-	return score / num, nil
+	devs, _, err := selectSubset(candidates, must, size, n.subsetScorer(cfg, ""))
+	if err != nil {
+		return nil, err
+	}
+	return deviceUUIDs(devs), nil
 }
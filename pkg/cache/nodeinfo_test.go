@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+// newTestNodeInfo is a node of the synthetic topology of gpus GPUs
+func newTestNodeInfo(gpus int) *NodeInfo {
+	return newNamedTestNodeInfo("node", gpus)
+}
+
+func newNamedTestNodeInfo(name string, gpus int) *NodeInfo {
+	n := NewNodeInfo(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	n.topology = syntheticTopology(gpus)
+	return n
+}
+
+// newTestCache is a cache of the nodes, the nodes are listed too
+func newTestCache(nodes ...*NodeInfo) *SchedulerCache {
+	nodeIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{})
+	podIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{clientgocache.NamespaceIndex: clientgocache.MetaNamespaceIndexFunc})
+	c := NewSchedulerCache(corelisters.NewNodeLister(nodeIndexer), corelisters.NewPodLister(podIndexer), nil)
+	for _, n := range nodes {
+		nodeIndexer.Add(n.node)
+		c.nodes[n.name] = n
+	}
+	return c
+}
+
+// newTestPod is a pod requesting gpus GPUs of the resource
+func newTestPod(name, res string, gpus int64) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name: "main",
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceName(res): *resource.NewQuantity(gpus, resource.DecimalSI),
+			}},
+		}}},
+	}
+}
+
+// useGPUs assigns the first count GPUs of the node to the pod
+func useGPUs(n *NodeInfo, pod *v1.Pod, count int) {
+	uuids := deviceUUIDs(n.topology.GPUDevice[:count])
+	pod = pod.DeepCopy()
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[n.resource] = strings.Join(uuids, ",")
+	pod.Spec.NodeName = n.name
+	for _, uuid := range uuids {
+		n.devs[uuid] = pod
+	}
+}
+
+func TestPreferredAllocation(t *testing.T) {
+	n := newTestNodeInfo(8)
+	uuids := deviceUUIDs(n.topology.GPUDevice)
+	n.cordoned[uuids[3]] = true
+
+	tests := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		size        int
+		want        int
+		err         error
+	}{
+		{"no must include", uuids, nil, 4, 4, nil},
+		{"must include", uuids, uuids[:2], 4, 4, nil},
+		{"duplicate available", append(uuids[:2:2], uuids[:2]...), nil, 2, 2, nil},
+		{"duplicate available too few", append(uuids[:2:2], uuids[:2]...), nil, 3, 0, ErrInsufficientDevices},
+		{"unknown must include", uuids, []string{"GPU-unknown"}, 2, 0, ErrUnknownDevice},
+		{"duplicate must include", uuids, []string{uuids[0], uuids[0]}, 2, 0, ErrDuplicateDevice},
+		{"must include not available", uuids[1:], uuids[:1], 2, 0, ErrUnavailableDevice},
+		{"must include cordoned", uuids, uuids[3:4], 2, 0, ErrUnavailableDevice},
+		{"cordoned available skipped", uuids[2:5], nil, 3, 0, ErrInsufficientDevices},
+	}
+	for _, test := range tests {
+		got, err := n.PreferredAllocation(test.available, test.mustInclude, test.size, DefaultScoringConfig())
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(got) != test.want {
+			t.Errorf("%s: got %d devices, want %d", test.name, len(got), test.want)
+		}
+		seen := map[string]bool{}
+		for _, uuid := range got {
+			if seen[uuid] {
+				t.Errorf("%s: device %s chosen twice", test.name, uuid)
+			}
+			seen[uuid] = true
+		}
+		for _, uuid := range test.mustInclude {
+			if !seen[uuid] {
+				t.Errorf("%s: device %s must be included", test.name, uuid)
+			}
+		}
+	}
+}
@@ -152,7 +152,8 @@ const (
 
 type P2PLink struct {
 	BusID string
-	Link  P2PLinkType
+	// Link is decoded from the P2PLinkType number of the older topologies
+	Link LinkDescriptor
 }
 
 func (t P2PLinkType) String() string {
@@ -186,35 +187,9 @@ func (t P2PLinkType) String() string {
 	return "N/A"
 }
 
+// Score is the rank of the link descriptor, see LinkDescriptor.Rank
 func (t P2PLinkType) Score() int {
-	switch t {
-	case P2PLinkCrossCPU:
-		return 1
-	case P2PLinkSameCPU:
-		return 2
-	case P2PLinkHostBridge:
-		return 3
-	case P2PLinkMultiSwitch:
-		return 4
-	case P2PLinkSingleSwitch:
-		return 5
-	case P2PLinkSameBoard:
-		return 6
-	case SingleNVLINKLink:
-		return 4
-	case TwoNVLINKLinks:
-		return 5
-	case ThreeNVLINKLinks:
-		return 6
-	case FourNVLINKLinks:
-		return 7
-	case FiveNVLINKLinks:
-		return 8
-	case SixNVLINKLinks:
-		return 9
-	case P2PLinkUnknown:
-	}
-	return 0
+	return t.Descriptor().Rank()
 }
 
 type ClockInfo struct {
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	// maxRingDevices bounds the exhaustive search of the best ring, which
+	// runs for every subset the subset search tries, the larger subsets are
+	// chained greedily
+	maxRingDevices = 8
+)
+
+// patternScoreFunc scores a subset of devices in [0, maxSubsetScore] from
+// the scores of their links
+type patternScoreFunc func(devs []*Device, score pairScoreFunc) int
+
+// patternScorers score the subsets by the links the communication patterns
+// stress, the pattern which isn't here is scored by the default of the link
+// scorer
+var patternScorers = map[string]patternScoreFunc{
+	utils.CommPatternRing:            ringScore,
+	utils.CommPatternTree:            treeScore,
+	utils.CommPatternAllToAll:        allToAllScore,
+	utils.CommPatternParameterServer: parameterServerScore,
+}
+
+// pairScores is the matrix of the pair scores of the devices
+func pairScores(devs []*Device, score pairScoreFunc) [][]int {
+	scores := make([][]int, len(devs))
+	for i := range devs {
+		scores[i] = make([]int, len(devs))
+		for j := range devs {
+			if i != j {
+				scores[i][j] = score(devs[i], devs[j])
+			}
+		}
+	}
+	return scores
+}
+
+// ringScore is the score of the worst link of the best ring through the
+// devices, a Hamiltonian cycle which a ring allreduce is bounded by. A single
+// device has the best score as it has no links. The greedy ring is taken
+// when no ring can beat it, which is the common case of the links of a few
+// kinds, else the best ring is searched up to maxRingDevices.
+func ringScore(devs []*Device, score pairScoreFunc) int {
+	n := len(devs)
+	if n < 2 {
+		return maxSubsetScore
+	}
+	scores := pairScores(devs, score)
+	greedy := greedyRingScore(scores)
+	if n > maxRingDevices || greedy >= ringUpperBound(scores) {
+		return greedy
+	}
+	return bestRingScore(scores, greedy)
+}
+
+// ringUpperBound bounds the score of any ring. A ring is a spanning tree
+// with one more link so it's no better than the best spanning tree, and
+// every device of a ring has two links so it's no better than the second
+// best link of a device.
+func ringUpperBound(scores [][]int) int {
+	if len(scores) == 2 {
+		return scores[0][1]
+	}
+	bound := spanningTreeScore(scores)
+	for i, row := range scores {
+		first, second := -1, -1
+		for j, s := range row {
+			if j == i {
+				continue
+			}
+			if s > first {
+				first, second = s, first
+			} else if s > second {
+				second = s
+			}
+		}
+		bound = minInt(bound, second)
+	}
+	return bound
+}
+
+// bestRingScore searches the best ring through the devices by dynamic
+// programming over the subsets, the paths no better than floor are dropped
+func bestRingScore(scores [][]int, floor int) int {
+	n := len(scores)
+	// best[mask*n+last] is the best worst link of the paths from the device
+	// 0 through the devices in mask ending at last, -1 if there's none
+	full := 1 << uint(n)
+	best := make([]int, full*n)
+	for i := range best {
+		best[i] = -1
+	}
+	best[1*n+0] = maxSubsetScore
+	for mask := 1; mask < full; mask += 2 {
+		for last := 0; last < n; last++ {
+			cur := best[mask*n+last]
+			if cur <= floor {
+				continue
+			}
+			for next := 1; next < n; next++ {
+				if mask&(1<<uint(next)) != 0 {
+					continue
+				}
+				nextMask := mask | 1<<uint(next)
+				if s := minInt(cur, scores[last][next]); s > best[nextMask*n+next] {
+					best[nextMask*n+next] = s
+				}
+			}
+		}
+	}
+	ring := floor
+	for last := 1; last < n; last++ {
+		if s := minInt(best[(full-1)*n+last], scores[last][0]); s > ring {
+			ring = s
+		}
+	}
+	return ring
+}
+
+// greedyRingScore chains the devices by the best link to the last one
+// chained and closes the ring back to the device 0
+func greedyRingScore(scores [][]int) int {
+	n := len(scores)
+	used := make([]bool, n)
+	used[0] = true
+	last, ring := 0, maxSubsetScore
+	for k := 1; k < n; k++ {
+		next := -1
+		for j := 1; j < n; j++ {
+			if !used[j] && (next < 0 || scores[last][j] > scores[last][next]) {
+				next = j
+			}
+		}
+		used[next] = true
+		ring = minInt(ring, scores[last][next])
+		last = next
+	}
+	return minInt(ring, scores[last][0])
+}
+
+// treeScore is the score of the worst link of the best spanning tree of the
+// devices, the maximum spanning tree which a tree allreduce or a broadcast
+// can use
+func treeScore(devs []*Device, score pairScoreFunc) int {
+	n := len(devs)
+	if n < 2 {
+		return maxSubsetScore
+	}
+	return spanningTreeScore(pairScores(devs, score))
+}
+
+// spanningTreeScore is the worst link of the maximum spanning tree by Prim's
+// algorithm, link[i] is the best link of i to the tree
+func spanningTreeScore(scores [][]int) int {
+	n := len(scores)
+	inTree := make([]bool, n)
+	link := make([]int, n)
+	copy(link, scores[0])
+	inTree[0] = true
+	tree := maxSubsetScore
+	for k := 1; k < n; k++ {
+		next := -1
+		for j := 0; j < n; j++ {
+			if !inTree[j] && (next < 0 || link[j] > link[next]) {
+				next = j
+			}
+		}
+		inTree[next] = true
+		tree = minInt(tree, link[next])
+		for j := 0; j < n; j++ {
+			if !inTree[j] && scores[next][j] > link[j] {
+				link[j] = scores[next][j]
+			}
+		}
+	}
+	return tree
+}
+
+// allToAllScore weights the worst link equally with the average one, an
+// all-to-all exchange goes over every pair and waits for the slowest
+func allToAllScore(devs []*Device, score pairScoreFunc) int {
+	if len(devs) < 2 {
+		return maxSubsetScore
+	}
+	scores := pairScores(devs, score)
+	worst, sum, pairs := maxSubsetScore, 0, 0
+	for i := range scores {
+		for j := i + 1; j < len(scores); j++ {
+			worst = minInt(worst, scores[i][j])
+			sum += scores[i][j]
+			pairs++
+		}
+	}
+	return (worst + sum/pairs) / 2
+}
+
+// parameterServerScore is the worst link of the workers to the device which
+// serves the parameters, every worker waits for the slowest to sync. The
+// server is the first GPU of the allocation, see parameterServer, and it's
+// recorded in utils.AnnotationParameterServer of the pod.
+func parameterServerScore(devs []*Device, score pairScoreFunc) int {
+	if len(devs) < 2 {
+		return maxSubsetScore
+	}
+	_, best := parameterServer(pairScores(devs, score))
+	return best
+}
+
+// parameterServer picks the device with the best worst link to the others
+// to serve the parameters, it returns its index and that link
+func parameterServer(scores [][]int) (int, int) {
+	server, best := 0, -1
+	for i, row := range scores {
+		worst := maxSubsetScore
+		for j, s := range row {
+			if j != i {
+				worst = minInt(worst, s)
+			}
+		}
+		if worst > best {
+			server, best = i, worst
+		}
+	}
+	return server, best
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
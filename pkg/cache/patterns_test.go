@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func benchmarkBestFreeSubset(b *testing.B, num int64, scorer, pattern string) {
+	n := NewNodeInfo(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+	n.topology = syntheticTopology(16)
+	cfg := DefaultScoringConfig()
+	cfg.LinkScorer = scorer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := n.bestFreeSubset(num, cfg, pattern); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBestFreeSubsetRank8of16(b *testing.B) {
+	benchmarkBestFreeSubset(b, 8, LinkScorerRank, "")
+}
+
+func BenchmarkBestFreeSubsetBandwidth8of16(b *testing.B) {
+	benchmarkBestFreeSubset(b, 8, LinkScorerBandwidth, "")
+}
+
+func BenchmarkBestFreeSubsetBandwidth12of16(b *testing.B) {
+	benchmarkBestFreeSubset(b, 12, LinkScorerBandwidth, "")
+}
+
+func BenchmarkBestFreeSubsetRing8of16(b *testing.B) {
+	benchmarkBestFreeSubset(b, 8, LinkScorerRank, utils.CommPatternRing)
+}
+
+func BenchmarkBestFreeSubsetParameterServer8of16(b *testing.B) {
+	benchmarkBestFreeSubset(b, 8, LinkScorerRank, utils.CommPatternParameterServer)
+}
+
+// bruteForceRingScore tries every ring through the devices from the device 0
+func bruteForceRingScore(scores [][]int) int {
+	n := len(scores)
+	best := 0
+	perm := make([]int, 0, n)
+	used := make([]bool, n)
+	var walk func(worst int)
+	walk = func(worst int) {
+		last := perm[len(perm)-1]
+		if len(perm) == n {
+			if s := minInt(worst, scores[last][0]); s > best {
+				best = s
+			}
+			return
+		}
+		for next := 1; next < n; next++ {
+			if !used[next] {
+				used[next] = true
+				perm = append(perm, next)
+				walk(minInt(worst, scores[last][next]))
+				perm = perm[:len(perm)-1]
+				used[next] = false
+			}
+		}
+	}
+	perm = append(perm, 0)
+	walk(maxSubsetScore)
+	return best
+}
+
+func TestRingScore(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		n := 2 + r.Intn(maxRingDevices-1)
+		devs := make([]*Device, n)
+		index := make(map[*Device]int, n)
+		for i := range devs {
+			devs[i] = &Device{UUID: fmt.Sprintf("GPU-%d", i)}
+			index[devs[i]] = i
+		}
+		// a few link kinds like the real topologies, symmetric
+		scores := make([][]int, n)
+		for i := range scores {
+			scores[i] = make([]int, n)
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				s := []int{10, 40, 70, 100}[r.Intn(4)]
+				scores[i][j], scores[j][i] = s, s
+			}
+		}
+		score := func(a, b *Device) int { return scores[index[a]][index[b]] }
+
+		if got, want := ringScore(devs, score), bruteForceRingScore(scores); got != want {
+			t.Fatalf("ring score of %v is %d, want %d", scores, got, want)
+		}
+	}
+}
+
+func TestParameterServerFirst(t *testing.T) {
+	// the GPU 2 has NVLinks to both others which only share PCIe
+	topo := &Topology{}
+	for i := 0; i < 3; i++ {
+		topo.GPUDevice = append(topo.GPUDevice, &Device{
+			UUID: fmt.Sprintf("GPU-%d", i),
+			PCI:  PCIInfo{BusID: fmt.Sprintf("00000000:%02X:00.0", i)},
+		})
+	}
+	links := [][]LinkDescriptor{
+		{{}, {Kind: LinkKindPCIeCrossCPU}, NVLinks(6)},
+		{{Kind: LinkKindPCIeCrossCPU}, {}, NVLinks(6)},
+		{NVLinks(6), NVLinks(6), {}},
+	}
+	for i, d := range topo.GPUDevice {
+		for j, peer := range topo.GPUDevice {
+			if i != j {
+				d.Topology = append(d.Topology, P2PLink{BusID: peer.PCI.BusID, Link: links[i][j]})
+			}
+		}
+	}
+	n := NewNodeInfo(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+	n.topology = topo
+
+	devs, score, err := n.bestFreeSubset(3, DefaultScoringConfig(), utils.CommPatternParameterServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devs[0].UUID != "GPU-2" {
+		t.Errorf("the parameter server is %s, want GPU-2", devs[0].UUID)
+	}
+	if score != maxSubsetScore {
+		t.Errorf("the score is %d, want %d", score, maxSubsetScore)
+	}
+}
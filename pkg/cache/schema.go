@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// APIVersionV1Alpha1 is the shape of Topology, the topology without
+	// apiVersion is decoded as v1alpha1
+	APIVersionV1Alpha1 = "topology.gpucloud.io/v1alpha1"
+	// APIVersionV1Beta1 is the shape of TopologyV1Beta1
+	APIVersionV1Beta1 = "topology.gpucloud.io/v1beta1"
+)
+
+// TopologyV1Beta1 describes the node topology with an explicit link matrix
+// between the GPUs, the NICs and the NUMA distances.
+type TopologyV1Beta1 struct {
+	APIVersion string           `json:"apiVersion"`
+	SystemInfo HostSystemInfo   `json:"systemInfo"`
+	CPUInfo    HostCPUInfo      `json:"cpuInfo"`
+	CPUPkg     []HostCPUPackage `json:"cpuPkg,omitempty"`
+	MemorySize int64            `json:"memorySize"`
+	NumaInfo   *HostNumaInfo    `json:"numaInfo,omitempty"`
+	SmcPresent *bool            `json:"smcPresent,omitempty"`
+	GPUDevices []DeviceV1Beta1  `json:"gpuDevices,omitempty"`
+	// LinkMatrix[i][j] is the link between GPUDevices[i] and GPUDevices[j],
+	// the diagonal is ignored. The links are either descriptors or the
+	// P2PLinkType numbers of the older topologies.
+	LinkMatrix [][]LinkDescriptor `json:"linkMatrix,omitempty"`
+	NICs       []NIC              `json:"nics,omitempty"`
+}
+
+// DeviceV1Beta1 is the GPU device without its links
+type DeviceV1Beta1 struct {
+	UUID                  string                    `json:"uuid"`
+	Path                  string                    `json:"path,omitempty"`
+	Model                 *string                   `json:"model,omitempty"`
+	Power                 *uint                     `json:"power,omitempty"`
+	Memory                *uint64                   `json:"memory,omitempty"`
+	CPUAffinity           *uint                     `json:"cpuAffinity,omitempty"`
+	PCI                   PCIInfo                   `json:"pci"`
+	Clocks                ClockInfo                 `json:"clocks"`
+	CudaComputeCapability CudaComputeCapabilityInfo `json:"cudaComputeCapability"`
+}
+
+type topologyVersion struct {
+	APIVersion string `json:"apiVersion"`
+}
+
+// DecodeTopology decodes the topology of any supported apiVersion into Topology
+func DecodeTopology(data []byte) (*Topology, error) {
+	var v topologyVersion
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	switch v.APIVersion {
+	case "", APIVersionV1Alpha1:
+		var t Topology
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		t.APIVersion = APIVersionV1Alpha1
+		return &t, nil
+	case APIVersionV1Beta1:
+		var t TopologyV1Beta1
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		return ConvertV1Beta1ToV1Alpha1(&t)
+	}
+	return nil, fmt.Errorf("unsupported topology apiVersion %q", v.APIVersion)
+}
+
+// ConvertV1Alpha1ToV1Beta1 builds the link matrix from the links of the devices
+func ConvertV1Alpha1ToV1Beta1(in *Topology) (*TopologyV1Beta1, error) {
+	out := &TopologyV1Beta1{
+		APIVersion: APIVersionV1Beta1,
+		SystemInfo: in.SystemInfo,
+		CPUInfo:    in.CPUInfo,
+		CPUPkg:     in.CPUPkg,
+		MemorySize: in.MemorySize,
+		NumaInfo:   in.NumaInfo,
+		SmcPresent: in.SmcPresent,
+		NICs:       in.NICs,
+	}
+
+	n := len(in.GPUDevice)
+	out.GPUDevices = make([]DeviceV1Beta1, 0, n)
+	out.LinkMatrix = make([][]LinkDescriptor, n)
+	for i, d := range in.GPUDevice {
+		if d == nil {
+			return nil, fmt.Errorf("gpuDevice[%d] is null", i)
+		}
+		out.GPUDevices = append(out.GPUDevices, DeviceV1Beta1{
+			UUID:                  d.UUID,
+			Path:                  d.Path,
+			Model:                 d.Model,
+			Power:                 d.Power,
+			Memory:                d.Memory,
+			CPUAffinity:           d.CPUAffinity,
+			PCI:                   d.PCI,
+			Clocks:                d.Clocks,
+			CudaComputeCapability: d.CudaComputeCapability,
+		})
+		out.LinkMatrix[i] = make([]LinkDescriptor, n)
+		for j, peer := range in.GPUDevice {
+			if i != j && peer != nil {
+				out.LinkMatrix[i][j] = linkBetween(d, peer)
+			}
+		}
+	}
+	return out, nil
+}
+
+// ConvertV1Beta1ToV1Alpha1 expands the link matrix into the links of the devices
+func ConvertV1Beta1ToV1Alpha1(in *TopologyV1Beta1) (*Topology, error) {
+	n := len(in.GPUDevices)
+	if len(in.LinkMatrix) != n {
+		return nil, fmt.Errorf("linkMatrix has %d rows, expected %d", len(in.LinkMatrix), n)
+	}
+	for i, row := range in.LinkMatrix {
+		if len(row) != n {
+			return nil, fmt.Errorf("linkMatrix[%d] has %d columns, expected %d", i, len(row), n)
+		}
+	}
+
+	out := &Topology{
+		APIVersion: APIVersionV1Alpha1,
+		SystemInfo: in.SystemInfo,
+		CPUInfo:    in.CPUInfo,
+		CPUPkg:     in.CPUPkg,
+		MemorySize: in.MemorySize,
+		NumaInfo:   in.NumaInfo,
+		SmcPresent: in.SmcPresent,
+		NICs:       in.NICs,
+		GPUDevice:  make([]*Device, 0, n),
+	}
+	for i, d := range in.GPUDevices {
+		dev := &Device{
+			UUID:                  d.UUID,
+			Path:                  d.Path,
+			Model:                 d.Model,
+			Power:                 d.Power,
+			Memory:                d.Memory,
+			CPUAffinity:           d.CPUAffinity,
+			PCI:                   d.PCI,
+			Clocks:                d.Clocks,
+			CudaComputeCapability: d.CudaComputeCapability,
+			Topology:              make([]P2PLink, 0, n-1),
+		}
+		for j, peer := range in.GPUDevices {
+			if i == j {
+				continue
+			}
+			dev.Topology = append(dev.Topology, P2PLink{BusID: peer.PCI.BusID, Link: in.LinkMatrix[i][j]})
+		}
+		out.GPUDevice = append(out.GPUDevice, dev)
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestConvertTopologyRoundTrip(t *testing.T) {
+	in := syntheticTopology(16)
+	in.APIVersion = APIVersionV1Alpha1
+
+	beta, err := ConvertV1Alpha1ToV1Beta1(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := beta.LinkMatrix[0][1]; got != NVLinks(6) {
+		t.Errorf("linkMatrix[0][1] is %v, want %v", got, NVLinks(6))
+	}
+	if got := beta.LinkMatrix[0][8]; got.Kind != LinkKindPCIeCrossCPU {
+		t.Errorf("linkMatrix[0][8] is %v, want SYS", got)
+	}
+
+	out, err := ConvertV1Beta1ToV1Alpha1(beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("the round trip through v1beta1 changed the topology")
+	}
+
+	// and through the annotation
+	data, err := json.Marshal(beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeTopology(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, decoded) {
+		t.Errorf("decoding the v1beta1 topology changed it")
+	}
+}
+
+func TestDecodeTopology(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		link LinkDescriptor
+		err  bool
+	}{
+		{
+			name: "v1alpha1 without apiVersion and with the legacy link numbers",
+			data: `{"gpuDevice":[{"UUID":"GPU-0","PCI":{"BusID":"0"},"Topology":[{"BusID":"1","Link":8}]},
+				{"UUID":"GPU-1","PCI":{"BusID":"1"},"Topology":[{"BusID":"0","Link":8}]}]}`,
+			link: NVLinks(2),
+		},
+		{
+			name: "v1beta1 with the legacy link numbers",
+			data: `{"apiVersion":"topology.gpucloud.io/v1beta1","gpuDevices":[{"uuid":"GPU-0","pci":{"BusID":"0"}},{"uuid":"GPU-1","pci":{"BusID":"1"}}],
+				"linkMatrix":[[0,1],[1,0]]}`,
+			link: LinkDescriptor{Kind: LinkKindPCIeCrossCPU},
+		},
+		{
+			name: "v1beta1 with the descriptors",
+			data: `{"apiVersion":"topology.gpucloud.io/v1beta1","gpuDevices":[{"uuid":"GPU-0","pci":{"BusID":"0"}},{"uuid":"GPU-1","pci":{"BusID":"1"}}],
+				"linkMatrix":[[{},{"kind":"xgmi","count":2,"bandwidth":100}],[{"kind":"xgmi","count":2,"bandwidth":100},{}]]}`,
+			link: XGMILinks(2),
+		},
+		{
+			name: "v1beta1 with a missing row",
+			data: `{"apiVersion":"topology.gpucloud.io/v1beta1","gpuDevices":[{"uuid":"GPU-0"},{"uuid":"GPU-1"}],"linkMatrix":[[0,40]]}`,
+			err:  true,
+		},
+		{
+			name: "v1beta1 with a ragged row",
+			data: `{"apiVersion":"topology.gpucloud.io/v1beta1","gpuDevices":[{"uuid":"GPU-0"},{"uuid":"GPU-1"}],"linkMatrix":[[0,40],[40]]}`,
+			err:  true,
+		},
+		{
+			name: "unsupported apiVersion",
+			data: `{"apiVersion":"topology.gpucloud.io/v2"}`,
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		topo, err := DecodeTopology([]byte(test.data))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if topo.APIVersion != APIVersionV1Alpha1 {
+			t.Errorf("%s: apiVersion is %q", test.name, topo.APIVersion)
+		}
+		if got := linkBetween(topo.GPUDevice[0], topo.GPUDevice[1]); got != test.link {
+			t.Errorf("%s: the link is %v, want %v", test.name, got, test.link)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// builtinLinkTypes are the link types of the built-in score table
+var builtinLinkTypes = []P2PLinkType{
+	P2PLinkCrossCPU, P2PLinkSameCPU, P2PLinkHostBridge, P2PLinkMultiSwitch, P2PLinkSingleSwitch, P2PLinkSameBoard,
+	SingleNVLINKLink, TwoNVLINKLinks, ThreeNVLINKLinks, FourNVLINKLinks, FiveNVLINKLinks, SixNVLINKLinks,
+}
+
+// ValidateLinkScoreKey checks the key of the score table is a link
+// abbreviation, see ParseLinkDescriptor
+func ValidateLinkScoreKey(key string) error {
+	d, err := ParseLinkDescriptor(key)
+	if err != nil || !d.Known() {
+		return fmt.Errorf("must be SYS, NODE, PHB, PXB, PIX, BOARD, NV<n> or XGMI<n>")
+	}
+	return nil
+}
+
+// DefaultLinkScores is the score table of the built-in link scores, the
+// links left out are scored by their rank
+func DefaultLinkScores() map[string]int {
+	scores := make(map[string]int, len(builtinLinkTypes))
+	for _, t := range builtinLinkTypes {
+		d := t.Descriptor()
+		scores[d.Key()] = d.Rank()
+	}
+	return scores
+}
+
+// ScoringConfig weights the components of the GPU subset score
+type ScoringConfig struct {
+	// LinkWeight weights the quality of the links between the GPUs
+	LinkWeight int `json:"linkWeight"`
+	// ThermalWeight weights the power headroom and the temperature of the
+	// GPUs, 0 disables the thermal scoring
+	ThermalWeight int `json:"thermalWeight"`
+	// ReferenceTemperature is the temperature scored 0, the cooler GPUs
+	// score linearly higher
+	ReferenceTemperature uint `json:"referenceTemperature"`
+	// LinkScores scores the links by their abbreviations, e.g. NV2, XGMI4,
+	// the pair scores are on a log scale up to the best of them and of the
+	// built-in ones, see linkScale. The links left out are scored by their
+	// rank, so the scores must follow the bandwidth of the links.
+	LinkScores map[string]int `json:"linkScores,omitempty"`
+	// ResourceLinkScores override LinkScores for the GPUs of the managed
+	// resources, keyed by the resource name and then by the link score key
+	// or the vendor's link type of the resource
+	ResourceLinkScores map[string]map[string]int `json:"resourceLinkScores,omitempty"`
+	// DefaultStrategy places the pods without the placement strategy
+	// annotation, binpack if empty
+	DefaultStrategy string `json:"defaultStrategy,omitempty"`
+	// LinkScorer scores the links of a GPU subset, LinkScorerRank by the
+	// score table or LinkScorerBandwidth by the estimated bandwidth of the
+	// best ring. It's LinkScorerRank if empty.
+	LinkScorer string `json:"linkScorer,omitempty"`
+	// ReferenceBandwidth is the ring bandwidth in GB/s which gets the best
+	// score of LinkScorerBandwidth, DefaultReferenceBandwidth if 0
+	ReferenceBandwidth float64 `json:"referenceBandwidth,omitempty"`
+}
+
+// DefaultScoringConfig only scores the links
+func DefaultScoringConfig() *ScoringConfig {
+	return &ScoringConfig{
+		LinkWeight:           1,
+		ThermalWeight:        0,
+		ReferenceTemperature: 90,
+		LinkScores:           DefaultLinkScores(),
+		DefaultStrategy:      utils.PlacementStrategyBinpack,
+		LinkScorer:           LinkScorerRank,
+		ReferenceBandwidth:   DefaultReferenceBandwidth,
+	}
+}
+
+// ForResource returns the config scoring the GPUs of the managed resource
+func (cfg *ScoringConfig) ForResource(resource string) *ScoringConfig {
+	scores, ok := cfg.ResourceLinkScores[resource]
+	if !ok {
+		return cfg
+	}
+	var linkTypes map[string]string
+	if r, ok := utils.GetResource(resource); ok {
+		linkTypes = r.LinkTypes
+	}
+
+	out := *cfg
+	out.LinkScores = make(map[string]int, len(cfg.LinkScores)+len(scores))
+	for k, score := range cfg.LinkScores {
+		out.LinkScores[k] = score
+	}
+	for k, score := range scores {
+		if key, ok := linkTypes[k]; ok {
+			k = key
+		}
+		out.LinkScores[k] = score
+	}
+	out.ResourceLinkScores = nil
+	return &out
+}
+
+// linkScore is the score of the link in the score table
+func (cfg *ScoringConfig) linkScore(d LinkDescriptor) int {
+	if score, ok := cfg.LinkScores[d.Key()]; ok {
+		return score
+	}
+	return d.Rank()
+}
+
+// linkScoreRange is the worst positive and the best score of the built-in
+// links and of the ones in the score table
+func (cfg *ScoringConfig) linkScoreRange() (int, int) {
+	var min, max int
+	add := func(score int) {
+		if score > 0 && (min == 0 || score < min) {
+			min = score
+		}
+		if score > max {
+			max = score
+		}
+	}
+	for _, t := range builtinLinkTypes {
+		add(cfg.linkScore(t.Descriptor()))
+	}
+	for _, score := range cfg.LinkScores {
+		add(score)
+	}
+	return min, max
+}
+
+// linkScale maps the link scores to [0, maxSubsetScore] on a log scale from
+// half the worst link to the best one. The PCIe links, a few GB/s apart, keep
+// apart after the mapping of the scores to the priorities next to the NVLinks
+// of up to 150 GB/s: SYS, PXB and PIX score 17, 39 and 42, NV1 and NV6 54 and
+// 100 by default.
+func (cfg *ScoringConfig) linkScale() func(score int) int {
+	min, max := cfg.linkScoreRange()
+	if max <= 0 {
+		return func(int) int { return 0 }
+	}
+	floor := float64(min) / 2
+	span := math.Log(float64(max) / floor)
+	return func(score int) int {
+		if score <= 0 {
+			return 0
+		}
+		if score >= max {
+			return maxSubsetScore
+		}
+		if s := int(maxSubsetScore * math.Log(float64(score)/floor) / span); s > 0 {
+			return s
+		}
+		return 0
+	}
+}
+
+// ValidateLinkScoreOrder checks the scores of the table follow the nominal
+// bandwidth of the links, the built-in links it leaves out score their rank.
+// A partial table in another scale, e.g. NV6: 9 next to the default PIX: 16,
+// is out of order.
+func ValidateLinkScoreOrder(scores map[string]int) error {
+	type scored struct {
+		key       string
+		bandwidth float64
+		score     int
+	}
+	var links []scored
+	for _, t := range builtinLinkTypes {
+		d := t.Descriptor()
+		if _, ok := scores[d.Key()]; !ok {
+			links = append(links, scored{d.Key(), d.nominalBandwidth(), d.Rank()})
+		}
+	}
+	for key, score := range scores {
+		d, err := ParseLinkDescriptor(key)
+		if err != nil || !d.Known() {
+			continue
+		}
+		links = append(links, scored{key, d.nominalBandwidth(), score})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].bandwidth != links[j].bandwidth {
+			return links[i].bandwidth < links[j].bandwidth
+		}
+		return links[i].key < links[j].key
+	})
+
+	// best is the best scored of the slower links, the links of the same
+	// bandwidth are compared to it before it's updated with them
+	var best *scored
+	for i := 0; i < len(links); {
+		j := i
+		for ; j < len(links) && links[j].bandwidth == links[i].bandwidth; j++ {
+			if l := links[j]; best != nil && l.score < best.score {
+				return fmt.Errorf("%s of %.0f GB/s scores %d, less than %s of %.0f GB/s scoring %d",
+					l.key, l.bandwidth, l.score, best.key, best.bandwidth, best.score)
+			}
+		}
+		for ; i < j; i++ {
+			if best == nil || links[i].score > best.score {
+				best = &links[i]
+			}
+		}
+	}
+	return nil
+}
+
+// placementStrategy is the strategy annotated on the pod, or the default one
+func (cfg *ScoringConfig) placementStrategy(pod *v1.Pod) string {
+	if _, ok := pod.Annotations[utils.AnnotationPlacementStrategy]; ok || cfg.DefaultStrategy == "" {
+		return utils.GetPlacementStrategy(pod)
+	}
+	return cfg.DefaultStrategy
+}
+
+// GetScoringConfig get the scoring config in use
+func (cache *SchedulerCache) GetScoringConfig() *ScoringConfig {
+	cache.nLock.RLock()
+	defer cache.nLock.RUnlock()
+	return cache.scoring
+}
+
+// SetScoringConfig replaces the scoring config
+func (cache *SchedulerCache) SetScoringConfig(cfg *ScoringConfig) {
+	cache.nLock.Lock()
+	defer cache.nLock.Unlock()
+	cache.scoring = cfg
+}
+
+// linkScorer scores the links of the subset of the devices on the node by
+// the link scorer of cfg and the communication pattern, see patternScorers.
+// Without a pattern the rank scorer averages the pair scores and the
+// bandwidth scorer scores the best ring. The caller should hold the lock.
+func (n *NodeInfo) linkScorer(cfg *ScoringConfig, pattern string) subsetScoreFunc {
+	score := averagePairScore
+	if cfg.LinkScorer == LinkScorerBandwidth {
+		score = ringScore
+	}
+	if s, ok := patternScorers[pattern]; ok {
+		score = s
+	}
+	pairScore := n.pairScoreMatrix(n.linkPairScorer(cfg))
+	return func(devs []*Device) int {
+		return score(devs, pairScore)
+	}
+}
+
+// linkPairScorer scores the link of two devices by the link scorer of cfg,
+// the caller should hold the lock
+func (n *NodeInfo) linkPairScorer(cfg *ScoringConfig) pairScoreFunc {
+	if cfg.LinkScorer == LinkScorerBandwidth {
+		return n.bandwidthScorer(cfg)
+	}
+	return n.pairScorer(cfg)
+}
+
+// pairScoreMatrix scores the pairs of the devices on the node once, as the
+// subset search scores the same pairs over and over. The devices which
+// aren't on the node are scored by score. The caller should hold the lock.
+func (n *NodeInfo) pairScoreMatrix(score pairScoreFunc) pairScoreFunc {
+	devs := n.topology.GPUDevice
+	index := make(map[*Device]int, len(devs))
+	scores := make([]int, len(devs)*len(devs))
+	for i, a := range devs {
+		index[a] = i
+		for j, b := range devs {
+			if i != j {
+				scores[i*len(devs)+j] = score(a, b)
+			}
+		}
+	}
+	return func(a, b *Device) int {
+		i, ok := index[a]
+		j, ok2 := index[b]
+		if !ok || !ok2 {
+			return score(a, b)
+		}
+		return scores[i*len(devs)+j]
+	}
+}
+
+// subsetScorer scores the subset of the devices on the node by their links
+// for the communication pattern and, if it's weighted, their thermal
+// headroom. The caller should hold the lock.
+func (n *NodeInfo) subsetScorer(cfg *ScoringConfig, pattern string) subsetScoreFunc {
+	linkScore := n.linkScorer(cfg, pattern)
+	return func(devs []*Device) int {
+		link := linkScore(devs)
+		if cfg.ThermalWeight <= 0 || len(devs) == 0 {
+			return link
+		}
+
+		var thermal int
+		for _, d := range devs {
+			thermal += n.thermalScore(d, cfg)
+		}
+		thermal /= len(devs)
+		return (link*cfg.LinkWeight + thermal*cfg.ThermalWeight) / (cfg.LinkWeight + cfg.ThermalWeight)
+	}
+}
+
+// thermalScore scores the power headroom and the temperature of the device
+// from its latest status in [0, maxSubsetScore], the device without status
+// gets the middle score. The caller should hold the lock.
+func (n *NodeInfo) thermalScore(d *Device, cfg *ScoringConfig) int {
+	s, ok := n.status[d.UUID]
+	if !ok {
+		return maxSubsetScore / 2
+	}
+
+	var sum, parts int
+	if s.Power != nil && d.Power != nil && *d.Power > 0 {
+		used := *s.Power
+		if used > *d.Power {
+			used = *d.Power
+		}
+		sum += int(*d.Power-used) * maxSubsetScore / int(*d.Power)
+		parts++
+	}
+	if s.Temperature != nil && cfg.ReferenceTemperature > 0 {
+		temp := *s.Temperature
+		if temp > cfg.ReferenceTemperature {
+			temp = cfg.ReferenceTemperature
+		}
+		sum += int(cfg.ReferenceTemperature-temp) * maxSubsetScore / int(cfg.ReferenceTemperature)
+		parts++
+	}
+	if parts == 0 {
+		return maxSubsetScore / 2
+	}
+	return sum / parts
+}
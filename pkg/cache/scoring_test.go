@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func TestThermalScore(t *testing.T) {
+	n := newTestNodeInfo(2)
+	d := n.topology.GPUDevice[0] // 350 W
+	cfg := DefaultScoringConfig()
+
+	tests := []struct {
+		name   string
+		status *DeviceStatus
+		want   int
+	}{
+		{"no status", nil, maxSubsetScore / 2},
+		{"no readings", &DeviceStatus{}, maxSubsetScore / 2},
+		{"idle and cool", &DeviceStatus{Power: uintPtr(0), Temperature: uintPtr(0)}, maxSubsetScore},
+		{"half power", &DeviceStatus{Power: uintPtr(175)}, 50},
+		{"power over the limit", &DeviceStatus{Power: uintPtr(400)}, 0},
+		{"temperature", &DeviceStatus{Temperature: uintPtr(45)}, 50},
+		{"temperature over the reference", &DeviceStatus{Temperature: uintPtr(95)}, 0},
+		{"power and temperature", &DeviceStatus{Power: uintPtr(175), Temperature: uintPtr(90)}, 25},
+	}
+	for _, test := range tests {
+		delete(n.status, d.UUID)
+		if test.status != nil {
+			n.status[d.UUID] = test.status
+		}
+		if got := n.thermalScore(d, cfg); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestThermalWeightAvoidsHotGPUs(t *testing.T) {
+	n := newTestNodeInfo(8)
+	hot := n.topology.GPUDevice[0]
+	for _, d := range n.topology.GPUDevice {
+		n.status[d.UUID] = &DeviceStatus{Power: uintPtr(50), Temperature: uintPtr(40)}
+	}
+	n.status[hot.UUID] = &DeviceStatus{Power: uintPtr(340), Temperature: uintPtr(88)}
+
+	cfg := DefaultScoringConfig()
+	devs, _, err := n.bestFreeSubset(1, cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devs[0] != hot {
+		t.Fatalf("the links alone should tie and keep the first GPU, got %s", devs[0].UUID)
+	}
+
+	cfg.ThermalWeight = 1
+	devs, _, err = n.bestFreeSubset(4, cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if d == hot {
+			t.Errorf("the hot GPU was chosen with the thermal weight")
+		}
+	}
+}
+
+// TestLinkScoresKeepPCIeApart checks the default link scores still rank the
+// PCIe links after the mapping of the scores to the priorities in [0, 10]
+func TestLinkScoresKeepPCIeApart(t *testing.T) {
+	links := []LinkDescriptor{
+		{Kind: LinkKindPCIeCrossCPU},
+		{Kind: LinkKindPCIeMultiSwitch},
+		{Kind: LinkKindPCIeSingleSwitch},
+		NVLinks(1),
+		NVLinks(6),
+	}
+	pod := newTestPod("pod", utils.DefaultResourceName(), 2)
+
+	last := -1
+	for _, l := range links {
+		n := newTestNodeInfo(2)
+		for _, d := range n.topology.GPUDevice {
+			d.Topology[0].Link = l
+		}
+		score, err := n.MakeScore(pod, 2, DefaultScoringConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score <= last {
+			t.Errorf("%s: got priority %d, want more than %d of the slower link", l.Key(), score, last)
+		}
+		last = score
+	}
+	if last != 10 {
+		t.Errorf("got priority %d for the best link, want 10", last)
+	}
+}
+
+func TestValidateLinkScoreOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		scores  map[string]int
+		wantErr bool
+	}{
+		{name: "defaults", scores: DefaultLinkScores()},
+		{name: "none"},
+		{name: "partial in GB/s", scores: map[string]int{"PIX": 20, "NV2": 45}},
+		{name: "same bandwidth in any order", scores: map[string]int{"PIX": 16, "BOARD": 15}},
+		{name: "partial in another scale", scores: map[string]int{"NV1": 4, "NV2": 5, "NV6": 9}, wantErr: true},
+		{name: "merged with the defaults", scores: merge(DefaultLinkScores(), map[string]int{"NV6": 9}), wantErr: true},
+		{name: "inverted PCIe", scores: map[string]int{"SYS": 15}, wantErr: true},
+		{name: "xGMI above NVLink", scores: map[string]int{"XGMI2": 100}, wantErr: false},
+		{name: "xGMI below NVLink", scores: map[string]int{"XGMI4": 100}, wantErr: true},
+		{name: "xGMI below a slower NVLink", scores: map[string]int{"XGMI2": 60}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := ValidateLinkScoreOrder(test.scores); (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func merge(a, b map[string]int) map[string]int {
+	for k, v := range b {
+		a[k] = v
+	}
+	return a
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// NodeSnapshot is the serializable scheduling state of a node, it's enough
+// to rebuild the NodeInfo and score it again
+type NodeSnapshot struct {
+	Name string `json:"name"`
+	// Resource of the GPUs, the default managed resource if empty
+	Resource  string                   `json:"resource,omitempty"`
+	Topology  *Topology                `json:"topology"`
+	Baseline  *Topology                `json:"baseline,omitempty"`
+	Devs      map[string]PodRef        `json:"devs,omitempty"`
+	Degraded  []DegradedLink           `json:"degraded,omitempty"`
+	Status    map[string]*DeviceStatus `json:"status,omitempty"`
+	Throttled map[string]int           `json:"throttled,omitempty"`
+	Unhealthy map[string]string        `json:"unhealthy,omitempty"`
+	Cordoned  []string                 `json:"cordoned,omitempty"`
+}
+
+// PodRef identifies the pod holding a GPU
+type PodRef struct {
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Snapshot copies the scheduling state of the node
+func (n *NodeInfo) Snapshot() *NodeSnapshot {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	s := &NodeSnapshot{
+		Name:      n.name,
+		Resource:  n.resource,
+		Topology:  n.topology,
+		Baseline:  n.baseline,
+		Devs:      make(map[string]PodRef, len(n.devs)),
+		Status:    make(map[string]*DeviceStatus, len(n.status)),
+		Throttled: make(map[string]int, len(n.throttled)),
+		Unhealthy: make(map[string]string, len(n.unhealthy)),
+	}
+	for uuid, pod := range n.devs {
+		s.Devs[uuid] = PodRef{Namespace: pod.Namespace, Name: pod.Name, Annotations: pod.Annotations}
+	}
+	for _, l := range n.degraded {
+		s.Degraded = append(s.Degraded, l)
+	}
+	for uuid, status := range n.status {
+		s.Status[uuid] = status
+	}
+	for uuid, c := range n.throttled {
+		s.Throttled[uuid] = c
+	}
+	for uuid, reason := range n.unhealthy {
+		s.Unhealthy[uuid] = reason
+	}
+	for uuid := range n.cordoned {
+		s.Cordoned = append(s.Cordoned, uuid)
+	}
+	return s
+}
+
+// restore replaces the scheduling state of the node with the snapshot
+func (n *NodeInfo) restore(s *NodeSnapshot) {
+	n.rwmu.Lock()
+	defer n.rwmu.Unlock()
+
+	n.topology = s.Topology
+	if n.topology == nil {
+		n.topology = &Topology{}
+	}
+	n.resource = s.Resource
+	if n.resource == "" {
+		n.resource = utils.DefaultResourceName()
+	}
+	n.baseline = s.Baseline
+	n.devs = make(map[string]*v1.Pod, len(s.Devs))
+	for uuid, ref := range s.Devs {
+		n.devs[uuid] = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name, Annotations: ref.Annotations}}
+	}
+	n.degraded = make(map[string]DegradedLink, len(s.Degraded))
+	for _, l := range s.Degraded {
+		n.degraded[pairKey(l.UUIDs[0], l.UUIDs[1])] = l
+	}
+	n.status = map[string]*DeviceStatus{}
+	for uuid, status := range s.Status {
+		n.status[uuid] = status
+	}
+	n.throttled = map[string]int{}
+	for uuid, c := range s.Throttled {
+		n.throttled[uuid] = c
+	}
+	n.unhealthy = map[string]string{}
+	for uuid, reason := range s.Unhealthy {
+		n.unhealthy[uuid] = reason
+	}
+	n.cordoned = map[string]bool{}
+	for _, uuid := range s.Cordoned {
+		n.cordoned[uuid] = true
+	}
+}
+
+// NodeInfo rebuilds a NodeInfo apart from the cache from the snapshot
+func (s *NodeSnapshot) NodeInfo() *NodeInfo {
+	n := NewNodeInfo(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: s.Name}})
+	n.restore(s)
+	return n
+}
+
+// SnapshotNodes copies the scheduling state of the known nodes among names
+func (cache *SchedulerCache) SnapshotNodes(names []string) []*NodeSnapshot {
+	cache.nLock.RLock()
+	defer cache.nLock.RUnlock()
+
+	var snapshots []*NodeSnapshot
+	for _, name := range names {
+		if n, ok := cache.nodes[name]; ok {
+			snapshots = append(snapshots, n.Snapshot())
+		}
+	}
+	return snapshots
+}
+
+// RestoreNode rebuilds the NodeInfo from the snapshot, the node must be known
+// by the node lister
+func (cache *SchedulerCache) RestoreNode(s *NodeSnapshot) error {
+	n, err := cache.GetNodeInfo(s.Name)
+	if err != nil {
+		return err
+	}
+	n.restore(s)
+	return nil
+}
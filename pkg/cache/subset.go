@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"errors"
+)
+
+const (
+	// maxSubsetCombinations bounds the exhaustive search in selectSubset,
+	// larger searches fall back to a greedy selection.
+	maxSubsetCombinations = 200000
+)
+
+var (
+	ErrInvalidAllocationSize = errors.New("invalid allocation size")
+	ErrInsufficientDevices   = errors.New("insufficient devices for the allocation")
+	ErrUnknownDevice         = errors.New("unknown device")
+	ErrUnavailableDevice     = errors.New("device not available")
+	ErrDuplicateDevice       = errors.New("duplicate device")
+)
+
+// linkBetween returns the P2P link from device a to device b, it's looked up
+// in a's topology by the PCI bus id of b.
+func linkBetween(a, b *Device) LinkDescriptor {
+	for _, l := range a.Topology {
+		if l.BusID == b.PCI.BusID {
+			return l.Link
+		}
+	}
+	return LinkDescriptor{}
+}
+
+// pairScoreFunc scores the connection between two devices
+type pairScoreFunc func(a, b *Device) int
+
+// subsetScoreFunc scores a subset of devices in [0, maxSubsetScore]
+type subsetScoreFunc func(devs []*Device) int
+
+const (
+	// maxSubsetScore is the score of the best subset
+	maxSubsetScore = 100
+)
+
+// averagePairScore averages the pair score of every device pair in the
+// subset, a single device has the best score as it has no links.
+func averagePairScore(devs []*Device, score pairScoreFunc) int {
+	if len(devs) < 2 {
+		return maxSubsetScore
+	}
+	var sum, pairs int
+	for i := range devs {
+		for j := i + 1; j < len(devs); j++ {
+			sum += score(devs[i], devs[j])
+			pairs++
+		}
+	}
+	return sum / pairs
+}
+
+// selectSubset picks size devices from candidates which contain all the
+// devices in mustInclude and have the best score. The candidates should not
+// contain the devices in mustInclude.
+func selectSubset(candidates, mustInclude []*Device, size int, score subsetScoreFunc) ([]*Device, int, error) {
+	if size <= 0 || len(mustInclude) > size {
+		return nil, 0, ErrInvalidAllocationSize
+	}
+	k := size - len(mustInclude)
+	if k > len(candidates) {
+		return nil, 0, ErrInsufficientDevices
+	}
+
+	if binomial(len(candidates), k) > maxSubsetCombinations {
+		best := greedySubset(candidates, mustInclude, size, score)
+		return best, score(best), nil
+	}
+
+	var (
+		best      []*Device
+		bestScore = -1
+		cur       = make([]*Device, 0, size)
+	)
+	cur = append(cur, mustInclude...)
+
+	var walk func(start int)
+	walk = func(start int) {
+		if len(cur) == size {
+			if sum := score(cur); sum > bestScore {
+				bestScore = sum
+				best = append(best[:0], cur...)
+			}
+			return
+		}
+		for i := start; i <= len(candidates)-(size-len(cur)); i++ {
+			cur = append(cur, candidates[i])
+			walk(i + 1)
+			cur = cur[:len(cur)-1]
+		}
+	}
+	walk(0)
+
+	return best, bestScore, nil
+}
+
+// greedySubset grows the subset from mustInclude by adding the candidate
+// which makes the best subset with the devices already chosen.
+func greedySubset(candidates, mustInclude []*Device, size int, score subsetScoreFunc) []*Device {
+	chosen := append([]*Device{}, mustInclude...)
+	left := append([]*Device{}, candidates...)
+	for len(chosen) < size {
+		bestIdx, bestGain := 0, -1
+		for i, d := range left {
+			gain := score(append(chosen, d))
+			if gain > bestGain {
+				bestIdx, bestGain = i, gain
+			}
+		}
+		chosen = append(chosen, left[bestIdx])
+		left = append(left[:bestIdx], left[bestIdx+1:]...)
+	}
+	return chosen
+}
+
+func binomial(n, k int) int {
+	if k < 0 || k > n {
+		return 0
+	}
+	if k > n-k {
+		k = n - k
+	}
+	r := 1
+	for i := 1; i <= k; i++ {
+		r = r * (n - k + i) / i
+		if r > maxSubsetCombinations {
+			return r
+		}
+	}
+	return r
+}
+
+func deviceUUIDs(devs []*Device) []string {
+	uuids := make([]string, 0, len(devs))
+	for _, d := range devs {
+		uuids = append(uuids, d.UUID)
+	}
+	return uuids
+}
@@ -0,0 +1,300 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TopologyTemplate is the GPU topology of a server model. The links use the
+// abbreviations of `nvidia-smi topo -m`, e.g. NV2, PIX, SYS, or XGMI<n> for
+// the xGMI links.
+type TopologyTemplate struct {
+	Model string `json:"model"`
+	// Aliases are the other names of the model, e.g. the DMI product names
+	Aliases    []string   `json:"aliases,omitempty"`
+	LinkMatrix [][]string `json:"linkMatrix"`
+}
+
+// TemplateRef is annotated by the nodes of a known model instead of the
+// full topology, the UUIDs are in the order of the template's link matrix.
+type TemplateRef struct {
+	Model string   `json:"model"`
+	UUIDs []string `json:"uuids"`
+}
+
+// ParseP2PLinkType parses the link abbreviation of `nvidia-smi topo -m`,
+// the NVLinks of more than six links are reported as SixNVLINKLinks.
+func ParseP2PLinkType(s string) (P2PLinkType, error) {
+	switch s {
+	case "X":
+		return P2PLinkUnknown, nil
+	case "SYS":
+		return P2PLinkCrossCPU, nil
+	case "NODE":
+		return P2PLinkSameCPU, nil
+	case "PHB":
+		return P2PLinkHostBridge, nil
+	case "PXB":
+		return P2PLinkMultiSwitch, nil
+	case "PIX":
+		return P2PLinkSingleSwitch, nil
+	}
+	var links int
+	if _, err := fmt.Sscanf(s, "NV%d", &links); err != nil || links < 1 {
+		return P2PLinkUnknown, ErrUnsupportedP2PLink
+	}
+	if links > 6 {
+		links = 6
+	}
+	return SingleNVLINKLink + P2PLinkType(links-1), nil
+}
+
+// parseLink parses the link abbreviation, or the vendor's link type named
+// by a link abbreviation in linkTypes
+func parseLink(s string, linkTypes map[string]string) (LinkDescriptor, error) {
+	if key, ok := linkTypes[s]; ok {
+		s = key
+	}
+	return ParseLinkDescriptor(s)
+}
+
+// Validate checks the link matrix of the template is square and symmetric
+func (t *TopologyTemplate) Validate() error {
+	return t.validate(nil)
+}
+
+// validate checks the template whose links may use the vendor's link types
+func (t *TopologyTemplate) validate(linkTypes map[string]string) error {
+	if t.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	// every row is checked before the symmetry reads the others
+	for i, row := range t.LinkMatrix {
+		if len(row) != len(t.LinkMatrix) {
+			return fmt.Errorf("linkMatrix[%d] has %d columns, expected %d", i, len(row), len(t.LinkMatrix))
+		}
+	}
+	for i, row := range t.LinkMatrix {
+		for j, l := range row {
+			if _, err := parseLink(l, linkTypes); err != nil {
+				return fmt.Errorf("linkMatrix[%d][%d]: %v %q", i, j, err, l)
+			}
+			if l != t.LinkMatrix[j][i] {
+				return fmt.Errorf("linkMatrix[%d][%d] %q doesn't match linkMatrix[%d][%d] %q", i, j, l, j, i, t.LinkMatrix[j][i])
+			}
+		}
+	}
+	return nil
+}
+
+// Expand builds the topology of a node from the template, the bus ids of
+// the devices are made up from the model and the index.
+func (t *TopologyTemplate) Expand(ref *TemplateRef) (*Topology, error) {
+	return t.expand(ref, nil)
+}
+
+// expand builds the topology with the vendor's link types
+func (t *TopologyTemplate) expand(ref *TemplateRef, linkTypes map[string]string) (*Topology, error) {
+	if err := t.validate(linkTypes); err != nil {
+		return nil, err
+	}
+	n := len(t.LinkMatrix)
+	if len(ref.UUIDs) != n {
+		return nil, fmt.Errorf("model %s has %d GPUs, but %d UUIDs are given", t.Model, n, len(ref.UUIDs))
+	}
+
+	out := &TopologyV1Beta1{
+		APIVersion: APIVersionV1Beta1,
+		SystemInfo: HostSystemInfo{Model: t.Model},
+		GPUDevices: make([]DeviceV1Beta1, 0, n),
+		LinkMatrix: make([][]LinkDescriptor, n),
+	}
+	for i, uuid := range ref.UUIDs {
+		out.GPUDevices = append(out.GPUDevices, DeviceV1Beta1{
+			UUID: uuid,
+			PCI:  PCIInfo{BusID: fmt.Sprintf("%s/%d", t.Model, i)},
+		})
+		out.LinkMatrix[i] = make([]LinkDescriptor, n)
+		for j, l := range t.LinkMatrix[i] {
+			out.LinkMatrix[i][j], _ = parseLink(l, linkTypes)
+		}
+	}
+	return ConvertV1Beta1ToV1Alpha1(out)
+}
+
+// TemplateRegistry holds the built-in templates and the ones loaded from
+// the ConfigMap, the latter override the former of the same model.
+type TemplateRegistry struct {
+	builtin   map[string]*TopologyTemplate
+	configMap map[string]*TopologyTemplate
+	// linkTypes are the vendors' link types of all the managed resources,
+	// the templates of the ConfigMap may use them
+	linkTypes map[string]string
+	rwmu      *sync.RWMutex
+}
+
+// NewTemplateRegistry return a registry with the built-in templates
+func NewTemplateRegistry() *TemplateRegistry {
+	r := &TemplateRegistry{
+		builtin:   map[string]*TopologyTemplate{},
+		configMap: map[string]*TopologyTemplate{},
+		rwmu:      new(sync.RWMutex),
+	}
+	for _, t := range builtinTemplates() {
+		addTemplate(r.builtin, t)
+	}
+	return r
+}
+
+func addTemplate(templates map[string]*TopologyTemplate, t *TopologyTemplate) {
+	templates[t.Model] = t
+	for _, alias := range t.Aliases {
+		templates[alias] = t
+	}
+}
+
+// Get the template of the model
+func (r *TemplateRegistry) Get(model string) (*TopologyTemplate, bool) {
+	r.rwmu.RLock()
+	defer r.rwmu.RUnlock()
+
+	if t, ok := r.configMap[model]; ok {
+		return t, true
+	}
+	t, ok := r.builtin[model]
+	return t, ok
+}
+
+// SetLinkTypes sets the vendors' link types of the managed resources, it
+// must be called before the ConfigMap is loaded
+func (r *TemplateRegistry) SetLinkTypes(linkTypes map[string]string) {
+	r.rwmu.Lock()
+	defer r.rwmu.Unlock()
+	r.linkTypes = linkTypes
+}
+
+// LoadConfigMap replaces the templates from the ConfigMap data, each value is
+// a template in YAML or JSON, the key is used as the model if it's not set.
+// The invalid templates are skipped and reported in the error.
+func (r *TemplateRegistry) LoadConfigMap(data map[string]string) error {
+	r.rwmu.RLock()
+	linkTypes := r.linkTypes
+	r.rwmu.RUnlock()
+
+	templates := map[string]*TopologyTemplate{}
+	var errs []string
+	for key, val := range data {
+		t := &TopologyTemplate{}
+		if err := yaml.Unmarshal([]byte(val), t); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		if t.Model == "" {
+			t.Model = key
+		}
+		if err := t.validate(linkTypes); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		addTemplate(templates, t)
+	}
+
+	r.rwmu.Lock()
+	r.configMap = templates
+	r.rwmu.Unlock()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid topology templates: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ExpandAnnotation builds the topology from the TemplateRef annotation, the
+// template may use the vendor's link types of linkTypes
+func (r *TemplateRegistry) ExpandAnnotation(val string, linkTypes map[string]string) (*Topology, error) {
+	var ref TemplateRef
+	if err := json.Unmarshal([]byte(val), &ref); err != nil {
+		return nil, err
+	}
+	t, ok := r.Get(ref.Model)
+	if !ok {
+		return nil, fmt.Errorf("unknown server model %q", ref.Model)
+	}
+	return t.expand(&ref, linkTypes)
+}
+
+func builtinTemplates() []*TopologyTemplate {
+	return []*TopologyTemplate{
+		{
+			Model:   "DGX-1V",
+			Aliases: []string{"DGX-1 with V100-16", "DGX-1 with V100-32"},
+			// the hybrid cube-mesh of NVLinks
+			LinkMatrix: [][]string{
+				{"X", "NV1", "NV1", "NV2", "NV2", "SYS", "SYS", "SYS"},
+				{"NV1", "X", "NV2", "NV1", "SYS", "NV2", "SYS", "SYS"},
+				{"NV1", "NV2", "X", "NV2", "SYS", "SYS", "NV1", "SYS"},
+				{"NV2", "NV1", "NV2", "X", "SYS", "SYS", "SYS", "NV1"},
+				{"NV2", "SYS", "SYS", "SYS", "X", "NV1", "NV1", "NV2"},
+				{"SYS", "NV2", "SYS", "SYS", "NV1", "X", "NV2", "NV1"},
+				{"SYS", "SYS", "NV1", "SYS", "NV1", "NV2", "X", "NV2"},
+				{"SYS", "SYS", "SYS", "NV1", "NV2", "NV1", "NV2", "X"},
+			},
+		},
+		{
+			Model: "DGX-2",
+			// every pair of GPUs is connected by the NVSwitches
+			LinkMatrix: uniformLinkMatrix(16, "NV6"),
+		},
+		{
+			Model:      "HGX-A100-8GPU",
+			Aliases:    []string{"DGX A100"},
+			LinkMatrix: uniformLinkMatrix(8, "NV12"),
+		},
+		{
+			Model: "Generic-8xPCIe",
+			// two sockets, each one has two PCIe switches with two GPUs
+			LinkMatrix: pcieLinkMatrix(8, 2, 4),
+		},
+	}
+}
+
+func uniformLinkMatrix(n int, link string) [][]string {
+	m := make([][]string, n)
+	for i := range m {
+		m[i] = make([]string, n)
+		for j := range m[i] {
+			if i == j {
+				m[i][j] = "X"
+			} else {
+				m[i][j] = link
+			}
+		}
+	}
+	return m
+}
+
+// pcieLinkMatrix builds the links of n GPUs, perSwitch GPUs share a PCIe
+// switch and perSocket GPUs share a CPU socket
+func pcieLinkMatrix(n, perSwitch, perSocket int) [][]string {
+	m := make([][]string, n)
+	for i := range m {
+		m[i] = make([]string, n)
+		for j := range m[i] {
+			switch {
+			case i == j:
+				m[i][j] = "X"
+			case i/perSwitch == j/perSwitch:
+				m[i][j] = "PIX"
+			case i/perSocket == j/perSocket:
+				m[i][j] = "NODE"
+			default:
+				m[i][j] = "SYS"
+			}
+		}
+	}
+	return m
+}
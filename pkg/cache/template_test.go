@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestTopologyTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		matrix [][]string
+		valid  bool
+	}{
+		{"valid", [][]string{{"X", "NV1", "SYS"}, {"NV1", "X", "PIX"}, {"SYS", "PIX", "X"}}, true},
+		{"empty", nil, true},
+		{"ragged last row", [][]string{{"X", "NV1", "NV1"}, {"NV1", "X", "NV1"}, {"NV1"}}, false},
+		{"ragged first row", [][]string{{"X"}, {"NV1", "X", "NV1"}, {"NV1", "NV1", "X"}}, false},
+		{"too long row", [][]string{{"X", "NV1", "NV1"}, {"NV1", "X"}}, false},
+		{"empty row", [][]string{{"X", "NV1"}, {}}, false},
+		{"asymmetric", [][]string{{"X", "NV1"}, {"NV2", "X"}}, false},
+		{"unknown link", [][]string{{"X", "FOO"}, {"FOO", "X"}}, false},
+	}
+	for _, test := range tests {
+		tmpl := &TopologyTemplate{Model: "model", LinkMatrix: test.matrix}
+		if err := tmpl.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestLoadConfigMapSkipsRaggedTemplate(t *testing.T) {
+	r := NewTemplateRegistry()
+	err := r.LoadConfigMap(map[string]string{
+		"ragged": "linkMatrix: [[X, NV1, NV1], [NV1, X, NV1], [NV1]]",
+		"good":   "linkMatrix: [[X, NV2], [NV2, X]]",
+	})
+	if err == nil {
+		t.Errorf("the ragged template wasn't reported")
+	}
+	if _, ok := r.Get("good"); !ok {
+		t.Errorf("the valid template wasn't loaded")
+	}
+	if _, ok := r.Get("ragged"); ok {
+		t.Errorf("the ragged template was loaded")
+	}
+}
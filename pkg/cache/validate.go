@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateTopology checks the structural consistency of the topology, the
+// field paths of the errors follow its JSON encoding.
+func ValidateTopology(t *Topology) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateCPUInfo(&t.CPUInfo, field.NewPath("cpuInfo"))...)
+	if t.NumaInfo != nil {
+		allErrs = append(allErrs, validateNumaInfo(t.NumaInfo, &t.CPUInfo, field.NewPath("numaInfo"))...)
+	}
+	allErrs = append(allErrs, validateGPUDevices(t.GPUDevice, field.NewPath("gpuDevice"))...)
+	for i, nic := range t.NICs {
+		if len(nic.GPULinks) > 0 && len(nic.GPULinks) != len(t.GPUDevice) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("nics").Index(i).Child("gpuLinks"), len(nic.GPULinks),
+				fmt.Sprintf("must have a link to each of the %d devices", len(t.GPUDevice))))
+		}
+	}
+
+	return allErrs
+}
+
+func validateCPUInfo(info *HostCPUInfo, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if info.NumCPUThreads < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("numCPUThreads"), info.NumCPUThreads, "must be non-negative"))
+	}
+	if info.NumCPUThreads > 0 && info.NumCPUCores > info.NumCPUThreads {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("numCPUCores"), info.NumCPUCores, "must not exceed NumCPUThreads"))
+	}
+	return allErrs
+}
+
+func validateNumaInfo(info *HostNumaInfo, cpuInfo *HostCPUInfo, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(info.NumaNode) > 0 && int(info.NumNodes) != len(info.NumaNode) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("numNodes"), info.NumNodes,
+			fmt.Sprintf("must match the length of numaNode (%d)", len(info.NumaNode))))
+	}
+
+	for i, row := range info.Distances {
+		if len(info.Distances) != len(info.NumaNode) || len(row) != len(info.NumaNode) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("distances").Index(i), len(row),
+				fmt.Sprintf("must be a %dx%d matrix", len(info.NumaNode), len(info.NumaNode))))
+			break
+		}
+	}
+
+	var total int
+	seen := map[int16]bool{}
+	for i, node := range info.NumaNode {
+		idxPath := fldPath.Child("numaNode").Index(i)
+		total += len(node.CPUID)
+		for j, cpu := range node.CPUID {
+			cpuPath := idxPath.Child("cpuID").Index(j)
+			if cpu < 0 || (cpuInfo.NumCPUThreads > 0 && cpu >= cpuInfo.NumCPUThreads) {
+				allErrs = append(allErrs, field.Invalid(cpuPath, cpu,
+					fmt.Sprintf("must be in the range [0, %d)", cpuInfo.NumCPUThreads)))
+			}
+			if seen[cpu] {
+				allErrs = append(allErrs, field.Duplicate(cpuPath, cpu))
+			}
+			seen[cpu] = true
+		}
+	}
+	if cpuInfo.NumCPUThreads > 0 && total > int(cpuInfo.NumCPUThreads) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("numaNode"), total,
+			fmt.Sprintf("the number of CPUs must not exceed NumCPUThreads (%d)", cpuInfo.NumCPUThreads)))
+	}
+
+	return allErrs
+}
+
+func validateGPUDevices(devs []*Device, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	uuids := map[string]bool{}
+	busIDs := map[string]int{}
+	for i, d := range devs {
+		idxPath := fldPath.Index(i)
+		if d == nil {
+			allErrs = append(allErrs, field.Required(idxPath, "device must not be null"))
+			continue
+		}
+		switch {
+		case d.UUID == "":
+			allErrs = append(allErrs, field.Required(idxPath.Child("UUID"), ""))
+		case uuids[d.UUID]:
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("UUID"), d.UUID))
+		}
+		uuids[d.UUID] = true
+
+		busPath := idxPath.Child("PCI", "BusID")
+		if d.PCI.BusID == "" {
+			allErrs = append(allErrs, field.Required(busPath, ""))
+		} else if _, ok := busIDs[d.PCI.BusID]; ok {
+			allErrs = append(allErrs, field.Duplicate(busPath, d.PCI.BusID))
+		} else {
+			busIDs[d.PCI.BusID] = i
+		}
+	}
+	if len(allErrs) > 0 {
+		// the links can't be checked without unique devices
+		return allErrs
+	}
+
+	for i, d := range devs {
+		topoPath := fldPath.Index(i).Child("Topology")
+		if len(d.Topology) != len(devs)-1 {
+			allErrs = append(allErrs, field.Invalid(topoPath, len(d.Topology),
+				fmt.Sprintf("must have a link to each of the other %d devices", len(devs)-1)))
+		}
+		linked := map[string]bool{}
+		for j, l := range d.Topology {
+			linkPath := topoPath.Index(j)
+			peer, ok := busIDs[l.BusID]
+			switch {
+			case !ok:
+				allErrs = append(allErrs, field.NotFound(linkPath.Child("BusID"), l.BusID))
+				continue
+			case peer == i:
+				allErrs = append(allErrs, field.Invalid(linkPath.Child("BusID"), l.BusID, "must not link the device to itself"))
+				continue
+			case linked[l.BusID]:
+				allErrs = append(allErrs, field.Duplicate(linkPath.Child("BusID"), l.BusID))
+				continue
+			}
+			linked[l.BusID] = true
+
+			if !l.Link.Known() {
+				allErrs = append(allErrs, field.Invalid(linkPath.Child("Link"), l.Link, "unsupported P2P link type"))
+			}
+			if back := linkBetween(devs[peer], d); back != l.Link {
+				allErrs = append(allErrs, field.Invalid(linkPath.Child("Link"), l.Link,
+					fmt.Sprintf("must match the reverse link %q of gpuDevice[%d]", back, peer)))
+			}
+		}
+	}
+
+	return allErrs
+}
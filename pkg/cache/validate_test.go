@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestValidateTopology(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(t *Topology)
+		field  string
+	}{
+		{"valid", func(t *Topology) {}, ""},
+		{"negative threads", func(t *Topology) { t.CPUInfo.NumCPUThreads = -1 }, "cpuInfo.numCPUThreads"},
+		{"more cores than threads", func(t *Topology) { t.CPUInfo.NumCPUCores = 128 }, "cpuInfo.numCPUCores"},
+		{"NUMA node count", func(t *Topology) {
+			t.NumaInfo = &HostNumaInfo{NumNodes: 2, NumaNode: []HostNumaNode{{CPUID: []int16{0}}}}
+		}, "numaInfo.numNodes"},
+		{"NUMA distances", func(t *Topology) {
+			t.NumaInfo = &HostNumaInfo{NumNodes: 1, NumaNode: []HostNumaNode{{CPUID: []int16{0}}}, Distances: [][]int32{{10, 20}}}
+		}, "numaInfo.distances[0]"},
+		{"NUMA CPU out of range", func(t *Topology) {
+			t.NumaInfo = &HostNumaInfo{NumNodes: 1, NumaNode: []HostNumaNode{{CPUID: []int16{96}}}}
+		}, "numaInfo.numaNode[0].cpuID[0]"},
+		{"duplicate NUMA CPU", func(t *Topology) {
+			t.NumaInfo = &HostNumaInfo{NumNodes: 2, NumaNode: []HostNumaNode{{CPUID: []int16{0}}, {CPUID: []int16{0}}}}
+		}, "numaInfo.numaNode[1].cpuID[0]"},
+		{"missing UUID", func(t *Topology) { t.GPUDevice[1].UUID = "" }, "gpuDevice[1].UUID"},
+		{"duplicate UUID", func(t *Topology) { t.GPUDevice[1].UUID = t.GPUDevice[0].UUID }, "gpuDevice[1].UUID"},
+		{"duplicate bus id", func(t *Topology) { t.GPUDevice[2].PCI.BusID = t.GPUDevice[0].PCI.BusID }, "gpuDevice[2].PCI.BusID"},
+		{"missing link", func(t *Topology) { t.GPUDevice[0].Topology = t.GPUDevice[0].Topology[1:] }, "gpuDevice[0].Topology"},
+		{"unknown peer", func(t *Topology) { t.GPUDevice[0].Topology[0].BusID = "00000000:FF:00.0" }, "gpuDevice[0].Topology[0].BusID"},
+		{"link to itself", func(t *Topology) { t.GPUDevice[0].Topology[0].BusID = t.GPUDevice[0].PCI.BusID }, "gpuDevice[0].Topology[0].BusID"},
+		{"asymmetric link", func(t *Topology) { t.GPUDevice[0].Topology[0].Link = NVLinks(2) }, "gpuDevice[0].Topology[0].Link"},
+		{"unknown link", func(t *Topology) {
+			t.GPUDevice[0].Topology[0].Link = LinkDescriptor{}
+			t.GPUDevice[1].Topology[0].Link = LinkDescriptor{}
+		}, "gpuDevice[0].Topology[0].Link"},
+		{"NIC links", func(t *Topology) {
+			t.NICs = []NIC{{Name: "mlx5_0", GPULinks: []P2PLinkType{P2PLinkSingleSwitch}}}
+		}, "nics[0].gpuLinks"},
+	}
+	for _, test := range tests {
+		topo := syntheticTopology(4)
+		test.mutate(topo)
+		errs := ValidateTopology(topo)
+		if test.field == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %v", test.name, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 {
+			t.Errorf("%s: no error, want one on %s", test.name, test.field)
+			continue
+		}
+		if errs[0].Field != test.field {
+			t.Errorf("%s: error on %s, want %s: %v", test.name, errs[0].Field, test.field, errs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sort"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// Placement is where the pod would be placed on a node
+type Placement struct {
+	Node        string   `json:"node"`
+	Score       int      `json:"score"`
+	GPUs        []string `json:"gpus"`
+	LinkQuality int      `json:"linkQuality"`
+}
+
+// Place scores the node for the pod and chooses its GPUs the way the
+// priority and the bind would, without allocating them. It returns nil if
+// the node can't hold the pod.
+func (n *NodeInfo) Place(pod *v1.Pod, gpuTopoNum int64, cfg *ScoringConfig) (*Placement, error) {
+	n.rwmu.RLock()
+	defer n.rwmu.RUnlock()
+
+	if gpuTopoNum <= 0 || int64(len(n.freeDevices())) < gpuTopoNum {
+		return nil, nil
+	}
+	score, err := n.makeScore(pod, gpuTopoNum, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pattern := utils.GetCommPattern(pod)
+	devs, _, err := n.bestFreeSubset(gpuTopoNum, cfg, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Placement{
+		Node:        n.name,
+		Score:       score,
+		GPUs:        deviceUUIDs(devs),
+		LinkQuality: n.linkScorer(cfg, pattern)(devs),
+	}, nil
+}
+
+// WhatIf places the pod on every cached node of the resource, or only on the
+// given nodes if any, and ranks the nodes which can hold it by score and link quality. The
+// cache is left untouched.
+func (cache *SchedulerCache) WhatIf(pod *v1.Pod, resource string, gpuTopoNum int64, nodeNames []string, minLinkQuality int) ([]*Placement, error) {
+	cfg := cache.GetScoringConfig()
+
+	var wanted map[string]bool
+	if len(nodeNames) > 0 {
+		wanted = make(map[string]bool, len(nodeNames))
+		for _, name := range nodeNames {
+			wanted[name] = true
+		}
+	}
+
+	placements := []*Placement{}
+	for _, n := range cache.Nodes() {
+		if wanted != nil && !wanted[n.GetName()] {
+			continue
+		}
+		if n.Resource() != resource {
+			continue
+		}
+		p, err := n.Place(pod, gpuTopoNum, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.LinkQuality < minLinkQuality {
+			continue
+		}
+		placements = append(placements, p)
+	}
+
+	sort.SliceStable(placements, func(i, j int) bool {
+		if placements[i].Score != placements[j].Score {
+			return placements[i].Score > placements[j].Score
+		}
+		return placements[i].LinkQuality > placements[j].LinkQuality
+	})
+	return placements, nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func TestWhatIf(t *testing.T) {
+	free := newNamedTestNodeInfo("free", 8)
+	busy := newNamedTestNodeInfo("busy", 8)
+	useGPUs(busy, newTestPod("busy", utils.DefaultResourceName(), 7), 7)
+	amd := newNamedTestNodeInfo("amd", 8)
+	amd.resource = "amd.com/gpu"
+	c := newTestCache(free, busy, amd)
+
+	pod := newTestPod("pod", utils.DefaultResourceName(), 2)
+	devsBefore := len(free.devs)
+
+	placements, err := c.WhatIf(pod, utils.DefaultResourceName(), 2, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(placements) != 1 || placements[0].Node != "free" {
+		t.Fatalf("placements %+v, want only the free node of the resource", placements)
+	}
+	if p := placements[0]; len(p.GPUs) != 2 || p.LinkQuality != maxSubsetScore {
+		t.Errorf("placement %+v, want 2 GPUs on NVLinks", p)
+	}
+	if len(free.devs) != devsBefore {
+		t.Errorf("the what-if allocated GPUs")
+	}
+
+	tests := []struct {
+		name           string
+		gpus           int64
+		nodes          []string
+		minLinkQuality int
+		want           []string
+	}{
+		{"one GPU fits both", 1, nil, 0, []string{"busy", "free"}},
+		{"node names", 1, []string{"free"}, 0, []string{"free"}},
+		{"minimum link quality", 2, nil, maxSubsetScore + 1, []string{}},
+		{"too many GPUs", 9, nil, 0, []string{}},
+	}
+	for _, test := range tests {
+		placements, err := c.WhatIf(newTestPod("pod", utils.DefaultResourceName(), test.gpus), utils.DefaultResourceName(), test.gpus, test.nodes, test.minLinkQuality)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := []string{}
+		for _, p := range placements {
+			got = append(got, p.Node)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
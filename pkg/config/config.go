@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	// APIVersionV1Alpha1 is the version of the configuration file
+	APIVersionV1Alpha1 = "config.gpucloud.io/v1alpha1"
+	// Kind of the configuration file
+	Kind = "ExtenderConfiguration"
+)
+
+// Config is the configuration file of the extender
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	Server     ServerConfig        `json:"server"`
+	Controller ControllerConfig    `json:"controller"`
+	Cache      CacheConfig         `json:"cache"`
+	Scoring    cache.ScoringConfig `json:"scoring"`
+}
+
+// ServerConfig configures the HTTP servers
+type ServerConfig struct {
+	// Address the scheduler extender is served on
+	Address string `json:"address"`
+	// ShutdownTimeout bounds the wait for the requests in flight and the
+	// pending writes on shutdown
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout"`
+	Webhook         WebhookConfig   `json:"webhook"`
+	Record          RecordConfig    `json:"record"`
+}
+
+// WebhookConfig configures the mutating admission webhook
+type WebhookConfig struct {
+	// Address the webhook is served on, the webhook is disabled if empty
+	Address string `json:"address,omitempty"`
+	// CertFile and KeyFile are the TLS certificate, a self-signed one for
+	// Host is generated if they're empty
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	Host     string `json:"host"`
+	// SchedulerName injected into the GPU topology pods
+	SchedulerName string `json:"schedulerName"`
+	// PlacementStrategy injected into the GPU topology pods
+	PlacementStrategy string `json:"placementStrategy"`
+}
+
+// RecordConfig configures the recorder of the priority calls
+type RecordConfig struct {
+	// File the calls are recorded to, recording is disabled if empty
+	File     string `json:"file,omitempty"`
+	MaxBytes int64  `json:"maxBytes"`
+	MaxFiles int    `json:"maxFiles"`
+}
+
+// ControllerConfig configures the controller
+type ControllerConfig struct {
+	Workers int `json:"workers"`
+	// ResyncPeriod of the informers
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// TemplateConfigMap is the namespace/name of the ConfigMap of the
+	// topology templates
+	TemplateConfigMap string `json:"templateConfigMap,omitempty"`
+	// ConfigMap is the namespace/name of the ConfigMap whose config.yaml
+	// holds a configuration file, its scoring and health rules are applied
+	// on every change
+	ConfigMap          string               `json:"configMap,omitempty"`
+	TaintDegradedNodes bool                 `json:"taintDegradedNodes"`
+	LeaderElection     LeaderElectionConfig `json:"leaderElection"`
+	Descheduler        DeschedulerConfig    `json:"descheduler"`
+}
+
+// LeaderElectionConfig configures the Lease based leader election
+type LeaderElectionConfig struct {
+	Enabled       bool            `json:"enabled"`
+	Namespace     string          `json:"namespace"`
+	Name          string          `json:"name"`
+	Identity      string          `json:"identity,omitempty"`
+	Address       string          `json:"address,omitempty"`
+	LeaseDuration metav1.Duration `json:"leaseDuration"`
+	RenewDeadline metav1.Duration `json:"renewDeadline"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod"`
+}
+
+// DeschedulerConfig configures the descheduler
+type DeschedulerConfig struct {
+	Enabled          bool            `json:"enabled"`
+	DryRun           bool            `json:"dryRun"`
+	Interval         metav1.Duration `json:"interval"`
+	EvictionInterval metav1.Duration `json:"evictionInterval"`
+	// Windows are the maintenance windows, e.g. "Sat,Sun 01:00-05:00"
+	Windows        []string `json:"windows,omitempty"`
+	IslandSize     int      `json:"islandSize"`
+	MinLinkQuality int      `json:"minLinkQuality"`
+	MaxMigrations  int      `json:"maxMigrations"`
+	MaxPriority    int      `json:"maxPriority"`
+}
+
+// CacheConfig configures the scheduler cache
+type CacheConfig struct {
+	// Resources are the extended resources of the GPUs, the first one is the
+	// default of the nodes and the pods which don't tell theirs
+	Resources []utils.Resource  `json:"resources"`
+	Health    cache.HealthRules `json:"health"`
+}
+
+// Default returns the configuration used without a configuration file
+func Default() *Config {
+	return &Config{
+		APIVersion: APIVersionV1Alpha1,
+		Kind:       Kind,
+		Server: ServerConfig{
+			Address:         ":3767",
+			ShutdownTimeout: metav1.Duration{Duration: 30 * time.Second},
+			Webhook: WebhookConfig{
+				Host:              "gputopo-schd-extender.kube-system.svc",
+				SchedulerName:     "topo-scheduler",
+				PlacementStrategy: utils.PlacementStrategyBinpack,
+			},
+			Record: RecordConfig{
+				MaxBytes: 100 << 20,
+				MaxFiles: 5,
+			},
+		},
+		Controller: ControllerConfig{
+			Workers:      2,
+			ResyncPeriod: metav1.Duration{Duration: 30 * time.Second},
+			LeaderElection: LeaderElectionConfig{
+				Namespace:     "kube-system",
+				Name:          "gputopo-schd-extender",
+				LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+				RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+				RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+			},
+			Descheduler: DeschedulerConfig{
+				Interval:         metav1.Duration{Duration: 10 * time.Minute},
+				EvictionInterval: metav1.Duration{Duration: time.Minute},
+				IslandSize:       8,
+				MaxMigrations:    10,
+				MaxPriority:      1000000000,
+			},
+		},
+		Cache: CacheConfig{
+			Resources: []utils.Resource{utils.DefaultResource()},
+			Health:    *cache.DefaultHealthRules(),
+		},
+		Scoring: *cache.DefaultScoringConfig(),
+	}
+}
+
+// LoadFile reads the configuration file over cfg, the settings missing from
+// the file keep their values in cfg
+func LoadFile(path string, cfg *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return decode(data, path, cfg)
+}
+
+// decode the configuration from source over cfg, the source must tell its
+// version and kind
+func decode(data []byte, source string, cfg *Config) error {
+	var header metav1.TypeMeta
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("failed to decode the configuration %s: %v", source, err)
+	}
+	if header.APIVersion != APIVersionV1Alpha1 || header.Kind != Kind {
+		return fmt.Errorf("unsupported configuration %s %s in %s, expected %s %s", header.APIVersion, header.Kind, source, APIVersionV1Alpha1, Kind)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("failed to decode the configuration %s: %v", source, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExampleConfigIsDefault(t *testing.T) {
+	cfg := &Config{}
+	if err := LoadFile("../../docs/extender-config.yaml", cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the empty and the missing lists and maps are the same
+	got, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("docs/extender-config.yaml loads to\n%s\nwant the defaults\n%s", got, want)
+	}
+	if errs := Validate(cfg); len(errs) > 0 {
+		t.Errorf("the example configuration is invalid: %v", errs.ToAggregate())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	header := "apiVersion: " + APIVersionV1Alpha1 + "\nkind: " + Kind + "\n"
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		check   func(cfg *Config) bool
+	}{
+		{
+			name: "settings left out keep their values",
+			data: header + "controller:\n  workers: 4\n",
+			check: func(cfg *Config) bool {
+				return cfg.Controller.Workers == 4 && cfg.Controller.ResyncPeriod.Duration == 30*time.Second &&
+					cfg.Server.Address == ":3767"
+			},
+		},
+		{
+			name: "durations",
+			data: header + "server:\n  shutdownTimeout: 1m30s\n",
+			check: func(cfg *Config) bool {
+				return cfg.Server.ShutdownTimeout == metav1.Duration{Duration: 90 * time.Second}
+			},
+		},
+		{name: "unknown field", data: header + "controller:\n  wokers: 4\n", wantErr: "unknown field"},
+		{name: "duplicate field", data: header + "controller:\n  workers: 4\n  workers: 5\n", wantErr: "decode"},
+		{name: "wrong type", data: header + "controller:\n  workers: two\n", wantErr: "decode"},
+		{name: "missing version", data: "kind: " + Kind + "\n", wantErr: "unsupported configuration"},
+		{name: "other kind", data: "apiVersion: " + APIVersionV1Alpha1 + "\nkind: Policy\n", wantErr: "unsupported configuration"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			err := decode([]byte(test.data), "test", cfg)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.check(cfg) {
+				t.Errorf("got %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(cfg *Config)
+		// want are the field paths of the errors
+		want []string
+	}{
+		{name: "defaults", mutate: func(cfg *Config) {}},
+		{
+			name:   "no address",
+			mutate: func(cfg *Config) { cfg.Server.Address = "" },
+			want:   []string{"server.address"},
+		},
+		{
+			name:   "cert without key",
+			mutate: func(cfg *Config) { cfg.Server.Webhook.CertFile = "tls.crt" },
+			want:   []string{"server.webhook.keyFile"},
+		},
+		{
+			name:   "unknown placement strategy",
+			mutate: func(cfg *Config) { cfg.Server.Webhook.PlacementStrategy = "pack" },
+			want:   []string{"server.webhook.placementStrategy"},
+		},
+		{
+			name:   "no worker",
+			mutate: func(cfg *Config) { cfg.Controller.Workers = 0 },
+			want:   []string{"controller.workers"},
+		},
+		{
+			name:   "ConfigMap key",
+			mutate: func(cfg *Config) { cfg.Controller.ConfigMap = "a/b/c" },
+			want:   []string{"controller.configMap"},
+		},
+		{
+			name: "lease durations",
+			mutate: func(cfg *Config) {
+				cfg.Controller.LeaderElection.Enabled = true
+				cfg.Controller.LeaderElection.Identity = "me"
+				cfg.Controller.LeaderElection.RenewDeadline = metav1.Duration{Duration: 20 * time.Second}
+			},
+			want: []string{"controller.leaderElection.leaseDuration"},
+		},
+		{
+			name:   "leader election without identity",
+			mutate: func(cfg *Config) { cfg.Controller.LeaderElection.Enabled = true },
+			want:   []string{"controller.leaderElection.identity"},
+		},
+		{
+			name:   "maintenance window",
+			mutate: func(cfg *Config) { cfg.Controller.Descheduler.Windows = []string{"Sat 01:00-05:00", "nightly"} },
+			want:   []string{"controller.descheduler.windows[1]"},
+		},
+		{
+			name:   "no resource",
+			mutate: func(cfg *Config) { cfg.Cache.Resources = nil },
+			want:   []string{"cache.resources"},
+		},
+		{
+			name: "duplicate resource",
+			mutate: func(cfg *Config) {
+				r := cfg.Cache.Resources[0]
+				r.TopologyAnnotation, r.TemplateAnnotation = "a", "b"
+				cfg.Cache.Resources = append(cfg.Cache.Resources, r)
+			},
+			want: []string{"cache.resources[1].name"},
+		},
+		{
+			name: "shared annotation",
+			mutate: func(cfg *Config) {
+				r := cfg.Cache.Resources[0]
+				r.Name, r.TemplateAnnotation = "amd.com/gpu-topo", "b"
+				cfg.Cache.Resources = append(cfg.Cache.Resources, r)
+			},
+			want: []string{"cache.resources[1].topologyAnnotation"},
+		},
+		{
+			name: "vendor link type",
+			mutate: func(cfg *Config) {
+				cfg.Cache.Resources[0].LinkTypes = map[string]string{"XGMI": "FOO"}
+			},
+			want: []string{"cache.resources[0].linkTypes[XGMI]"},
+		},
+		{
+			name:   "negative throttle persistence",
+			mutate: func(cfg *Config) { cfg.Cache.Health.ThrottlePersistence = -1 },
+			want:   []string{"cache.health.throttlePersistence"},
+		},
+		{
+			name:   "no weight",
+			mutate: func(cfg *Config) { cfg.Scoring.LinkWeight, cfg.Scoring.ThermalWeight = 0, 0 },
+			want:   []string{"scoring"},
+		},
+		{
+			name:   "negative weight",
+			mutate: func(cfg *Config) { cfg.Scoring.LinkWeight, cfg.Scoring.ThermalWeight = 2, -1 },
+			want:   []string{"scoring.thermalWeight"},
+		},
+		{
+			name:   "link scores",
+			mutate: func(cfg *Config) { cfg.Scoring.LinkScores = map[string]int{"NV2": -1, "FOO": 3} },
+			want:   []string{"scoring.linkScores", "scoring.linkScores[FOO]", "scoring.linkScores[NV2]"},
+		},
+		{
+			name: "link scores in another scale",
+			mutate: func(cfg *Config) {
+				for k, score := range map[string]int{"NV1": 4, "NV2": 5, "NV3": 6, "NV4": 7, "NV5": 8, "NV6": 9} {
+					cfg.Scoring.LinkScores[k] = score
+				}
+			},
+			want: []string{"scoring.linkScores"},
+		},
+		{
+			name: "vendor link scores out of order",
+			mutate: func(cfg *Config) {
+				cfg.Cache.Resources[0].LinkTypes = map[string]string{"XGMI": "XGMI2"}
+				cfg.Scoring.ResourceLinkScores = map[string]map[string]int{cfg.Cache.Resources[0].Name: {"XGMI": 8}}
+			},
+			want: []string{"scoring.resourceLinkScores[nvidia.com/gpu-topo]"},
+		},
+		{
+			name: "link scores of an unknown resource",
+			mutate: func(cfg *Config) {
+				cfg.Scoring.ResourceLinkScores = map[string]map[string]int{"amd.com/gpu": {"NV2": 1}}
+			},
+			want: []string{"scoring.resourceLinkScores[amd.com/gpu]"},
+		},
+		{
+			name:   "link scorer",
+			mutate: func(cfg *Config) { cfg.Scoring.LinkScorer = "ring" },
+			want:   []string{"scoring.linkScorer"},
+		},
+		{
+			name: "several errors",
+			mutate: func(cfg *Config) {
+				cfg.Server.Record.MaxFiles = -1
+				cfg.Controller.Descheduler.Enabled = true
+				cfg.Controller.Descheduler.IslandSize = 0
+				cfg.Scoring.ReferenceTemperature = 0
+			},
+			want: []string{"controller.descheduler.islandSize", "scoring.referenceTemperature", "server.record.maxFiles"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			test.mutate(cfg)
+			var got []string
+			for _, err := range Validate(cfg) {
+				got = append(got, err.Field)
+			}
+			// the errors of a map are in no order
+			sort.Strings(got)
+			sort.Strings(test.want)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %v, want %v", Validate(cfg), test.want)
+			}
+		})
+	}
+}
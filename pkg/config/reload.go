@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	clientgocache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/metrics"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	// ConfigMapKey is the key of the configuration file in the ConfigMap
+	ConfigMapKey = "config.yaml"
+)
+
+var reloadsCounter = metrics.NewCounterVec("gpu_topo_config_reloads_total",
+	"The number of the configuration reloads by result.", "result")
+
+// Reloader applies the reloadable settings of a configuration, the scoring
+// config and the health rules, to the cache. The other settings are only
+// read on start.
+type Reloader struct {
+	cache *cache.SchedulerCache
+	// base is the configuration of the start, the file and the flags, the
+	// reloaded configurations are decoded over it
+	base *Config
+}
+
+// NewReloader creates the reloader of the cache, base is the configuration
+// the process started with
+func NewReloader(c *cache.SchedulerCache, base *Config) *Reloader {
+	return &Reloader{cache: c, base: base}
+}
+
+// Apply applies the reloadable settings of the valid configuration
+func (r *Reloader) Apply(cfg *Config, source string) {
+	scoring := cfg.Scoring
+	health := cfg.Cache.Health
+	active := r.cache.ApplyConfig(&scoring, &health, source)
+	klog.Infof("Applied the configuration version %s from %s", active.Version, source)
+}
+
+// Load decodes the configuration over the one of the start and applies it if
+// it's valid, the configuration in use is kept otherwise
+func (r *Reloader) Load(data []byte, source string) error {
+	cfg, err := copyConfig(r.base)
+	if err != nil {
+		reloadsCounter.Add(1, "invalid")
+		return err
+	}
+	if err := decode(data, source, cfg); err != nil {
+		reloadsCounter.Add(1, "invalid")
+		return err
+	}
+	// the resources are only read on start, the score tables are checked
+	// against the managed ones
+	if !sameResourceNames(cfg.Cache.Resources, utils.Resources) {
+		klog.Warningf("The resources of %s differ from the managed ones, they're only read on start", source)
+	}
+	cfg.Cache.Resources = utils.Resources
+	if errs := Validate(cfg); len(errs) > 0 {
+		reloadsCounter.Add(1, "invalid")
+		return fmt.Errorf("invalid configuration %s: %v", source, errs.ToAggregate())
+	}
+	r.Apply(cfg, source)
+	reloadsCounter.Add(1, "applied")
+	return nil
+}
+
+// LoadFile loads the configuration file, the settings it leaves out keep
+// their values of the start
+func (r *Reloader) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		reloadsCounter.Add(1, "invalid")
+		return err
+	}
+	return r.Load(data, path)
+}
+
+// ReloadOnSignal loads the configuration file on every value of reloadCh
+// until stopCh is closed
+func (r *Reloader) ReloadOnSignal(path string, reloadCh <-chan struct{}, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-reloadCh:
+			klog.Infof("Reloading the configuration file %s", path)
+			if err := r.LoadFile(path); err != nil {
+				klog.Errorf("Failed to reload the configuration, keep the one in use: %v", err)
+			}
+		}
+	}
+}
+
+// WatchConfigMap loads the configuration of the ConfigMap and reloads it on
+// its changes, the configuration in use is kept when it's deleted
+func (r *Reloader) WatchConfigMap(client kubernetes.Interface, namespace, name string, resync time.Duration, stopCh <-chan struct{}) error {
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(client, resync,
+		kubeinformers.WithNamespace(namespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(clientgocache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cm, ok := obj.(*v1.ConfigMap); ok {
+				r.syncConfigMap(cm)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCM, ok := oldObj.(*v1.ConfigMap)
+			if !ok {
+				return
+			}
+			if cm, ok := newObj.(*v1.ConfigMap); ok && cm.ResourceVersion != oldCM.ResourceVersion {
+				r.syncConfigMap(cm)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			klog.Warningf("The configuration ConfigMap %s/%s is deleted, keep the configuration in use", namespace, name)
+		},
+	})
+	go factory.Start(stopCh)
+
+	if ok := clientgocache.WaitForCacheSync(stopCh, informer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for the configuration ConfigMap %s/%s to sync", namespace, name)
+	}
+	klog.Infof("info: watching the configuration in ConfigMap %s/%s", namespace, name)
+	return nil
+}
+
+func (r *Reloader) syncConfigMap(cm *v1.ConfigMap) {
+	source := fmt.Sprintf("ConfigMap %s/%s@%s", cm.Namespace, cm.Name, cm.ResourceVersion)
+	data, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		klog.Warningf("The %s has no %s, keep the configuration in use", source, ConfigMapKey)
+		return
+	}
+	if err := r.Load([]byte(data), source); err != nil {
+		klog.Errorf("Failed to reload the configuration, keep the one in use: %v", err)
+	}
+}
+
+// copyConfig deep copies the configuration through its encoding
+func copyConfig(cfg *Config) (*Config, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func sameResourceNames(a, b []utils.Resource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func newTestReloader(base *Config) (*Reloader, *cache.SchedulerCache) {
+	nodeIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{})
+	podIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{clientgocache.NamespaceIndex: clientgocache.MetaNamespaceIndexFunc})
+	c := cache.NewSchedulerCache(corelisters.NewNodeLister(nodeIndexer), corelisters.NewPodLister(podIndexer), nil)
+	return NewReloader(c, base), c
+}
+
+func TestReloadKeepsStartupSettings(t *testing.T) {
+	// the thermal weight and the health rule are set by the flags
+	base := Default()
+	base.Scoring.ThermalWeight = 3
+	base.Cache.Health.MaxTemperature = 85
+	r, c := newTestReloader(base)
+
+	data := "apiVersion: " + APIVersionV1Alpha1 + "\nkind: " + Kind + "\nscoring:\n  linkScorer: bandwidth\n"
+	if err := r.Load([]byte(data), "test"); err != nil {
+		t.Fatal(err)
+	}
+	active := c.ActiveConfig()
+	if active.Scoring.LinkScorer != cache.LinkScorerBandwidth {
+		t.Errorf("got link scorer %q, want the reloaded %q", active.Scoring.LinkScorer, cache.LinkScorerBandwidth)
+	}
+	if active.Scoring.ThermalWeight != 3 || active.Health.MaxTemperature != 85 {
+		t.Errorf("got thermal weight %d and max temperature %d, want the ones of the start",
+			active.Scoring.ThermalWeight, active.Health.MaxTemperature)
+	}
+	if base.Scoring.LinkScorer != cache.LinkScorerRank {
+		t.Errorf("the reload changed the configuration of the start")
+	}
+}
+
+func TestReloadValidatesManagedResources(t *testing.T) {
+	resources := utils.Resources
+	defer func() { utils.Resources = resources }()
+	amd := utils.Resource{Name: "amd.com/gpu-topo", TopologyAnnotation: "amd.com/gpu-topo", TemplateAnnotation: "amd.com/gpu-topo-template"}
+	utils.Resources = []utils.Resource{utils.DefaultResource(), amd}
+
+	base := Default()
+	base.Cache.Resources = utils.Resources
+	r, c := newTestReloader(base)
+
+	header := "apiVersion: " + APIVersionV1Alpha1 + "\nkind: " + Kind + "\n"
+	// the file leaves out the resources, the managed ones are still used
+	valid := header + "cache:\n  resources:\n  - name: nvidia.com/gpu-topo\n    topologyAnnotation: a\n    templateAnnotation: b\n" +
+		"scoring:\n  resourceLinkScores:\n    amd.com/gpu-topo:\n      NV1: 30\n"
+	if err := r.Load([]byte(valid), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ActiveConfig().Scoring.ResourceLinkScores["amd.com/gpu-topo"]["NV1"]; got != 30 {
+		t.Errorf("got score %d, want the reloaded 30", got)
+	}
+
+	unknown := header + "scoring:\n  resourceLinkScores:\n    intel.com/gpu-topo:\n      NV1: 10\n"
+	if err := r.Load([]byte(unknown), "test"); err == nil {
+		t.Error("loaded the scores of an unmanaged resource")
+	}
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/controller"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// Validate checks the configuration, the field paths of the errors follow
+// its YAML encoding
+func Validate(cfg *Config) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateServer(&cfg.Server, field.NewPath("server"))...)
+	allErrs = append(allErrs, validateController(&cfg.Controller, field.NewPath("controller"))...)
+
+	cachePath := field.NewPath("cache")
+	allErrs = append(allErrs, validateResources(cfg.Cache.Resources, cachePath.Child("resources"))...)
+	if cfg.Cache.Health.ThrottlePersistence < 0 {
+		allErrs = append(allErrs, field.Invalid(cachePath.Child("health", "throttlePersistence"), cfg.Cache.Health.ThrottlePersistence, "must not be negative"))
+	}
+
+	scoringPath := field.NewPath("scoring")
+	if cfg.Scoring.LinkWeight < 0 {
+		allErrs = append(allErrs, field.Invalid(scoringPath.Child("linkWeight"), cfg.Scoring.LinkWeight, "must not be negative"))
+	}
+	if cfg.Scoring.ThermalWeight < 0 {
+		allErrs = append(allErrs, field.Invalid(scoringPath.Child("thermalWeight"), cfg.Scoring.ThermalWeight, "must not be negative"))
+	}
+	if cfg.Scoring.LinkWeight+cfg.Scoring.ThermalWeight <= 0 {
+		allErrs = append(allErrs, field.Invalid(scoringPath, cfg.Scoring.LinkWeight+cfg.Scoring.ThermalWeight, "the sum of the weights must be positive"))
+	}
+	if cfg.Scoring.ReferenceTemperature == 0 {
+		allErrs = append(allErrs, field.Invalid(scoringPath.Child("referenceTemperature"), cfg.Scoring.ReferenceTemperature, "must be positive"))
+	}
+	allErrs = append(allErrs, validateLinkScores(cfg.Scoring.LinkScores, nil, scoringPath.Child("linkScores"))...)
+	if err := cache.ValidateLinkScoreOrder(cfg.Scoring.LinkScores); err != nil {
+		allErrs = append(allErrs, field.Invalid(scoringPath.Child("linkScores"), cfg.Scoring.LinkScores, err.Error()))
+	}
+	for name, scores := range cfg.Scoring.ResourceLinkScores {
+		fldPath := scoringPath.Child("resourceLinkScores").Key(name)
+		r := findResource(cfg.Cache.Resources, name)
+		if r == nil {
+			allErrs = append(allErrs, field.NotFound(fldPath, name))
+			continue
+		}
+		allErrs = append(allErrs, validateLinkScores(scores, r.LinkTypes, fldPath)...)
+		if err := cache.ValidateLinkScoreOrder(resourceLinkScores(cfg.Scoring.LinkScores, scores, r.LinkTypes)); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, scores, err.Error()))
+		}
+	}
+	if st := cfg.Scoring.DefaultStrategy; st != "" && st != utils.PlacementStrategyBinpack && st != utils.PlacementStrategySpread {
+		allErrs = append(allErrs, field.NotSupported(scoringPath.Child("defaultStrategy"), st,
+			[]string{utils.PlacementStrategyBinpack, utils.PlacementStrategySpread}))
+	}
+	if ls := cfg.Scoring.LinkScorer; ls != "" && ls != cache.LinkScorerRank && ls != cache.LinkScorerBandwidth {
+		allErrs = append(allErrs, field.NotSupported(scoringPath.Child("linkScorer"), ls,
+			[]string{cache.LinkScorerRank, cache.LinkScorerBandwidth}))
+	}
+	if cfg.Scoring.ReferenceBandwidth < 0 {
+		allErrs = append(allErrs, field.Invalid(scoringPath.Child("referenceBandwidth"), cfg.Scoring.ReferenceBandwidth, "must not be negative"))
+	}
+
+	return allErrs
+}
+
+func validateResources(resources []utils.Resource, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(resources) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "at least one resource is managed"))
+	}
+	names := map[string]bool{}
+	annotations := map[string]bool{}
+	for i, r := range resources {
+		idxPath := fldPath.Index(i)
+		if parts := strings.Split(r.Name, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), r.Name, "must be an extended resource name like vendor.com/gpu"))
+		} else if names[r.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), r.Name))
+		}
+		names[r.Name] = true
+
+		for _, a := range []struct {
+			name, value string
+		}{{"topologyAnnotation", r.TopologyAnnotation}, {"templateAnnotation", r.TemplateAnnotation}} {
+			switch {
+			case a.value == "":
+				allErrs = append(allErrs, field.Required(idxPath.Child(a.name), ""))
+			case annotations[a.value]:
+				allErrs = append(allErrs, field.Duplicate(idxPath.Child(a.name), a.value))
+			}
+			annotations[a.value] = true
+		}
+
+		for name, key := range r.LinkTypes {
+			if err := cache.ValidateLinkScoreKey(key); err != nil {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("linkTypes").Key(name), key, err.Error()))
+			}
+		}
+	}
+	return allErrs
+}
+
+func findResource(resources []utils.Resource, name string) *utils.Resource {
+	for i := range resources {
+		if resources[i].Name == name {
+			return &resources[i]
+		}
+	}
+	return nil
+}
+
+// resourceLinkScores is the score table of the GPUs of a resource, its
+// scores keyed by the link score keys over the common ones
+func resourceLinkScores(common, scores map[string]int, linkTypes map[string]string) map[string]int {
+	merged := make(map[string]int, len(common)+len(scores))
+	for k, score := range common {
+		merged[k] = score
+	}
+	for k, score := range scores {
+		if key, ok := linkTypes[k]; ok {
+			k = key
+		}
+		merged[k] = score
+	}
+	return merged
+}
+
+// validateLinkScores checks the score table keyed by the link abbreviations
+// or the vendor's link types
+func validateLinkScores(scores map[string]int, linkTypes map[string]string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	var best int
+	for k, score := range scores {
+		if _, ok := linkTypes[k]; !ok {
+			if err := cache.ValidateLinkScoreKey(k); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(k), k, err.Error()))
+			}
+		}
+		if score < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(k), score, "must not be negative"))
+		}
+		if score > best {
+			best = score
+		}
+	}
+	if len(scores) > 0 && best == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, best, "some link score must be positive"))
+	}
+	return allErrs
+}
+
+func validateServer(s *ServerConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if s.Address == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("address"), ""))
+	}
+	if s.ShutdownTimeout.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("shutdownTimeout"), s.ShutdownTimeout.Duration.String(), "must not be negative"))
+	}
+
+	webhookPath := fldPath.Child("webhook")
+	if (s.Webhook.CertFile == "") != (s.Webhook.KeyFile == "") {
+		allErrs = append(allErrs, field.Invalid(webhookPath.Child("keyFile"), s.Webhook.KeyFile, "certFile and keyFile must be set together"))
+	}
+	if s.Webhook.Address != "" && s.Webhook.SchedulerName == "" {
+		allErrs = append(allErrs, field.Required(webhookPath.Child("schedulerName"), ""))
+	}
+	if st := s.Webhook.PlacementStrategy; st != utils.PlacementStrategyBinpack && st != utils.PlacementStrategySpread {
+		allErrs = append(allErrs, field.NotSupported(webhookPath.Child("placementStrategy"), st,
+			[]string{utils.PlacementStrategyBinpack, utils.PlacementStrategySpread}))
+	}
+
+	recordPath := fldPath.Child("record")
+	if s.Record.MaxBytes < 0 {
+		allErrs = append(allErrs, field.Invalid(recordPath.Child("maxBytes"), s.Record.MaxBytes, "must not be negative"))
+	}
+	if s.Record.MaxFiles < 0 {
+		allErrs = append(allErrs, field.Invalid(recordPath.Child("maxFiles"), s.Record.MaxFiles, "must not be negative"))
+	}
+	return allErrs
+}
+
+func validateController(c *ControllerConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if c.Workers <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workers"), c.Workers, "must be positive"))
+	}
+	if c.ResyncPeriod.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("resyncPeriod"), c.ResyncPeriod.Duration.String(), "must be positive"))
+	}
+	if c.TemplateConfigMap != "" && !validConfigMapKey(c.TemplateConfigMap) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("templateConfigMap"), c.TemplateConfigMap, "must be namespace/name"))
+	}
+	if c.ConfigMap != "" && !validConfigMapKey(c.ConfigMap) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("configMap"), c.ConfigMap, "must be namespace/name"))
+	}
+
+	le := &c.LeaderElection
+	lePath := fldPath.Child("leaderElection")
+	if le.Enabled {
+		if le.Namespace == "" {
+			allErrs = append(allErrs, field.Required(lePath.Child("namespace"), ""))
+		}
+		if le.Name == "" {
+			allErrs = append(allErrs, field.Required(lePath.Child("name"), ""))
+		}
+		if le.Identity == "" {
+			allErrs = append(allErrs, field.Required(lePath.Child("identity"), ""))
+		}
+		if le.RetryPeriod.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(lePath.Child("retryPeriod"), le.RetryPeriod.Duration.String(), "must be positive"))
+		}
+		if le.RenewDeadline.Duration <= le.RetryPeriod.Duration {
+			allErrs = append(allErrs, field.Invalid(lePath.Child("renewDeadline"), le.RenewDeadline.Duration.String(), "must be longer than the retry period"))
+		}
+		if le.LeaseDuration.Duration <= le.RenewDeadline.Duration {
+			allErrs = append(allErrs, field.Invalid(lePath.Child("leaseDuration"), le.LeaseDuration.Duration.String(), "must be longer than the renew deadline"))
+		}
+	}
+
+	d := &c.Descheduler
+	dPath := fldPath.Child("descheduler")
+	if d.Enabled {
+		if d.Interval.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(dPath.Child("interval"), d.Interval.Duration.String(), "must be positive"))
+		}
+		if d.EvictionInterval.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(dPath.Child("evictionInterval"), d.EvictionInterval.Duration.String(), "must not be negative"))
+		}
+		if d.IslandSize <= 0 {
+			allErrs = append(allErrs, field.Invalid(dPath.Child("islandSize"), d.IslandSize, "must be positive"))
+		}
+	}
+	for i, w := range d.Windows {
+		if _, err := controller.ParseMaintenanceWindow(w); err != nil {
+			allErrs = append(allErrs, field.Invalid(dPath.Child("windows").Index(i), w, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+func validConfigMapKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) <= 2 && parts[len(parts)-1] != ""
+}
@@ -2,6 +2,8 @@ package controller
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/api/core/v1"
@@ -19,6 +21,7 @@ import (
 	"k8s.io/klog"
 
 	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/leader"
 	"github.com/gpucloud/node-topology-manager/pkg/utils"
 )
 
@@ -42,6 +45,10 @@ type Controller struct {
 	// simultaneously in two different workers.
 	podQueue workqueue.RateLimitingInterface
 
+	// taintQueue holds the names of the nodes whose degraded taint is to be
+	// synced with the degraded links in the cache
+	taintQueue workqueue.RateLimitingInterface
+
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
@@ -56,6 +63,22 @@ type Controller struct {
 
 	// The cache to store the pod to be removed
 	removePodCache map[string]*v1.Pod
+
+	// elector gates the writes on the leadership, nil without leader election
+	elector *leader.Elector
+
+	// taintDegraded is set when the nodes with degraded links are tainted
+	taintDegraded bool
+
+	// workers is the number of the workers started by Run, it's accessed
+	// atomically
+	workers int32
+
+	// writes tracks the asynchronous API writes, no write starts once
+	// stopping is set
+	writes     sync.WaitGroup
+	writesLock sync.Mutex
+	stopping   bool
 }
 
 func NewController(clientset *kubernetes.Clientset, kubeInformerFactory kubeinformers.SharedInformerFactory, stopCh <-chan struct{}) (*Controller, error) {
@@ -68,6 +91,7 @@ func NewController(clientset *kubernetes.Clientset, kubeInformerFactory kubeinfo
 	c := &Controller{
 		clientset:      clientset,
 		podQueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "podQueue"),
+		taintQueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "taintQueue"),
 		recorder:       recorder,
 		removePodCache: map[string]*v1.Pod{},
 	}
@@ -105,13 +129,18 @@ func NewController(clientset *kubernetes.Clientset, kubeInformerFactory kubeinfo
 	nodeInformer := kubeInformerFactory.Core().V1().Nodes()
 	c.nodeLister = nodeInformer.Lister()
 	c.nodeInformerSynced = nodeInformer.Informer().HasSynced
+	nodeInformer.Informer().AddEventHandler(clientgocache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addNodeToCache,
+		UpdateFunc: c.updateNodeInCache,
+		DeleteFunc: c.deleteNodeFromCache,
+	})
+
+	// Create scheduler Cache, it's used by the event handlers
+	c.schedulerCache = cache.NewSchedulerCache(c.nodeLister, c.podLister, c.recorder)
 
 	// Start informer goroutines.
 	go kubeInformerFactory.Start(stopCh)
 
-	// Create scheduler Cache
-	c.schedulerCache = cache.NewSchedulerCache(c.nodeLister, c.podLister)
-
 	klog.Infoln("begin to wait for cache")
 
 	if ok := clientgocache.WaitForCacheSync(stopCh, c.nodeInformerSynced); !ok {
@@ -139,22 +168,43 @@ func (c *Controller) GetSchedulerCache() *cache.SchedulerCache {
 	return c.schedulerCache
 }
 
-// Run will set up the event handlers
+// Run will set up the event handlers, it returns once the workers are stopped
 func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
 	defer c.podQueue.ShutDown()
+	defer c.taintQueue.ShutDown()
 
 	klog.Infoln("Starting Topology Controller.")
 	klog.Infoln("Waiting for informer caches to sync")
 
 	klog.Infof("Starting %v workers.", threadiness)
+	var workers sync.WaitGroup
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(c.runWorker, time.Second, stopCh)
+		}()
+	}
+	if c.taintDegraded {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(c.runTaintWorker, time.Second, stopCh)
+		}()
 	}
+	atomic.StoreInt32(&c.workers, int32(threadiness))
 
 	klog.Infoln("Started workers")
 	<-stopCh
 	klog.Infoln("Shutting down workers")
+	// the workers waiting for the queue return at once, the busy ones
+	// finish their pods first
+	c.podQueue.ShutDown()
+	c.taintQueue.ShutDown()
+	workers.Wait()
+	atomic.StoreInt32(&c.workers, 0)
+	klog.Infoln("Stopped workers")
 
 	return nil
 }
@@ -323,3 +373,74 @@ func (c *Controller) deletePodFromCache(obj interface{}) {
 	c.podQueue.Add(podKey)
 	c.removePodCache[podKey] = pod
 }
+
+func (c *Controller) addNodeToCache(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		klog.Warningf("Failed to convert to *v1.Node: %#v", obj)
+		return
+	}
+	if err := c.schedulerCache.UpdateNodeTopology(node); err != nil {
+		klog.Warningf("Failed to update the topology of node %s: %v", node.Name, err)
+	}
+	if _, ok := node.Annotations[utils.AnnotationCordonedDevices]; ok {
+		if err := c.schedulerCache.UpdateCordonedDevices(node); err != nil {
+			klog.Warningf("Failed to update the cordoned GPUs of node %s: %v", node.Name, err)
+		}
+	}
+}
+
+func (c *Controller) updateNodeInCache(oldObj, newObj interface{}) {
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		klog.Warningf("cannot convert oldObj to *v1.Node: %v", oldObj)
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		klog.Warningf("cannot convert newObj to *v1.Node: %v", newObj)
+		return
+	}
+	if oldNode.Annotations[utils.AnnotationCordonedDevices] != newNode.Annotations[utils.AnnotationCordonedDevices] {
+		if err := c.schedulerCache.UpdateCordonedDevices(newNode); err != nil {
+			klog.Warningf("Failed to update the cordoned GPUs of node %s: %v", newNode.Name, err)
+		}
+	}
+	if !topologyAnnotationsChanged(oldNode, newNode) {
+		return
+	}
+	if err := c.schedulerCache.UpdateNodeTopology(newNode); err != nil {
+		klog.Warningf("Failed to update the topology of node %s: %v", newNode.Name, err)
+	}
+}
+
+func (c *Controller) deleteNodeFromCache(obj interface{}) {
+	var node *v1.Node
+	switch t := obj.(type) {
+	case *v1.Node:
+		node = t
+	case clientgocache.DeletedFinalStateUnknown:
+		var ok bool
+		if node, ok = t.Obj.(*v1.Node); !ok {
+			klog.Warningf("Failed to convert to *v1.Node: %#v", t.Obj)
+			return
+		}
+	default:
+		klog.Warningf("Failed to convert to *v1.Node: %#v", obj)
+		return
+	}
+	klog.V(2).Infof("Node %s is deleted", node.Name)
+	c.schedulerCache.RemoveNode(node.Name)
+}
+
+// topologyAnnotationsChanged checks the topology or the template annotation
+// of any managed resource changed
+func topologyAnnotationsChanged(oldNode, newNode *v1.Node) bool {
+	for _, r := range utils.Resources {
+		if oldNode.Annotations[r.TopologyAnnotation] != newNode.Annotations[r.TopologyAnnotation] ||
+			oldNode.Annotations[r.TemplateAnnotation] != newNode.Annotations[r.TemplateAnnotation] {
+			return true
+		}
+	}
+	return false
+}
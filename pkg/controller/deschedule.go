@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/metrics"
+)
+
+const (
+	// EventReasonDefragmented is the reason of the event on the evicted pods
+	EventReasonDefragmented = "GPUTopologyDefragmented"
+
+	// defragVerifyTimeout bounds the wait for an evicted pod to release its
+	// GPUs and for the island of its node to be restored
+	defragVerifyTimeout = 5 * time.Minute
+	defragVerifyPeriod  = 5 * time.Second
+)
+
+var (
+	deschedulerPlannedGauge = metrics.NewGaugeVec("gpu_topo_descheduler_planned_migrations",
+		"The number of the pod migrations in the last defragmentation plan.")
+	deschedulerDoneGauge = metrics.NewGaugeVec("gpu_topo_descheduler_done_migrations",
+		"The number of the pod migrations of the last defragmentation plan done.")
+	deschedulerRestoredCounter = metrics.NewCounterVec("gpu_topo_descheduler_restored_nodes_total",
+		"The number of the nodes evacuated by the descheduler by whether their island was restored.", "result")
+	deschedulerEvictionsCounter = metrics.NewCounterVec("gpu_topo_descheduler_evictions_total",
+		"The number of the pods evicted by the descheduler by result.", "result")
+)
+
+// MaintenanceWindow is a daily time range in the local time zone, on some
+// week days or every day
+type MaintenanceWindow struct {
+	Days  []time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseMaintenanceWindow parses a window like "Sat,Sun 01:00-05:00" or
+// "22:00-04:00", the end before the start crosses midnight
+func ParseMaintenanceWindow(s string) (*MaintenanceWindow, error) {
+	w := &MaintenanceWindow{}
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		for _, day := range strings.Split(fields[0], ",") {
+			d, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("invalid week day %q in maintenance window %q", day, s)
+			}
+			w.Days = append(w.Days, d)
+		}
+	default:
+		return nil, fmt.Errorf("invalid maintenance window %q", s)
+	}
+
+	times := strings.Split(fields[len(fields)-1], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid time range in maintenance window %q", s)
+	}
+	var err error
+	if w.Start, err = parseClock(times[0]); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseClock(times[1]); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %v", s, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains checks the time is in the window
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	if w.End <= w.Start && clock < w.End {
+		// the part after midnight belongs to the window of the day before
+		day = (day + 6) % 7
+	} else if w.End <= w.Start {
+		if clock < w.Start {
+			return false
+		}
+	} else if clock < w.Start || clock >= w.End {
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// DeschedulerConfig configures the descheduler
+type DeschedulerConfig struct {
+	// Interval between two defragmentation plans
+	Interval time.Duration
+	// EvictionInterval is the minimum time between two evictions
+	EvictionInterval time.Duration
+	// Windows are when the pods may be evicted, any time if empty
+	Windows []*MaintenanceWindow
+	// DryRun logs the evictions without doing them
+	DryRun bool
+	// Options of the defragmentation plan, the disruption budgets are listed
+	// before each plan
+	Options cache.DefragOptions
+}
+
+// RunDescheduler periodically evicts the pods of the defragmentation plan
+// until stopCh is closed, WaitForWrites waits for the eviction in progress
+func (c *Controller) RunDescheduler(cfg *DeschedulerConfig, stopCh <-chan struct{}) {
+	klog.Infof("Starting the descheduler, dry run: %v", cfg.DryRun)
+	if !c.startWrite() {
+		return
+	}
+	defer c.writes.Done()
+	wait.Until(func() { c.deschedule(cfg, stopCh) }, cfg.Interval, stopCh)
+}
+
+func (c *Controller) inMaintenanceWindow(cfg *DeschedulerConfig) bool {
+	if len(cfg.Windows) == 0 {
+		return true
+	}
+	now := time.Now()
+	for _, w := range cfg.Windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) deschedule(cfg *DeschedulerConfig, stopCh <-chan struct{}) {
+	if !c.isLeader() {
+		klog.V(2).Infof("Descheduler: not the leader, skip")
+		return
+	}
+	if !c.inMaintenanceWindow(cfg) {
+		klog.V(2).Infof("Descheduler: out of the maintenance windows, skip")
+		return
+	}
+
+	opts := cfg.Options
+	pdbs, err := c.clientset.PolicyV1beta1().PodDisruptionBudgets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("Descheduler: failed to list the pod disruption budgets: %v", err)
+		return
+	}
+	for i := range pdbs.Items {
+		opts.PDBs = append(opts.PDBs, &pdbs.Items[i])
+	}
+
+	plan := c.schedulerCache.DefragPlan(&opts)
+	deschedulerPlannedGauge.Set(float64(len(plan.Migrations)))
+	deschedulerDoneGauge.Set(0)
+	if len(plan.Migrations) == 0 {
+		klog.V(2).Infof("Descheduler: no migration restores an island of %d GPUs", plan.IslandSize)
+		return
+	}
+	klog.Infof("Descheduler: %d migrations restore %d islands of %d GPUs",
+		len(plan.Migrations), plan.IslandsAfter-plan.IslandsBefore, plan.IslandSize)
+
+	// the migrations of a node are contiguous in the plan, the islands of
+	// the node are counted before its first eviction and checked after its
+	// last one, the evicted pods aren't steered to the planned GPUs so the
+	// plan stops when they come back and take the island again. A failed
+	// eviction leaves the node without its island, so its other migrations
+	// are skipped.
+	var islandsBefore int
+	var failed bool
+	for i, m := range plan.Migrations {
+		if i == 0 || plan.Migrations[i-1].From != m.From {
+			islandsBefore = c.nodeIslands(m.From, plan)
+			failed = false
+		} else if failed {
+			klog.V(2).Infof("Descheduler: skip pod %s/%s, an eviction from node %s failed", m.Namespace, m.Name, m.From)
+			continue
+		}
+		if i > 0 {
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(cfg.EvictionInterval):
+			}
+		}
+		if !c.isLeader() {
+			klog.Infof("Descheduler: lost the leadership, %d of %d migrations done", i, len(plan.Migrations))
+			return
+		}
+		if !c.inMaintenanceWindow(cfg) {
+			klog.Infof("Descheduler: the maintenance window is over, %d of %d migrations done", i, len(plan.Migrations))
+			return
+		}
+
+		if err := c.evict(m, plan, cfg.DryRun); err != nil {
+			if errors.IsTooManyRequests(err) {
+				deschedulerEvictionsCounter.Add(1, "aborted")
+				klog.Warningf("Descheduler: evicting pod %s/%s violates its disruption budget, abort the plan after %d of %d migrations: %v",
+					m.Namespace, m.Name, i, len(plan.Migrations), err)
+				return
+			}
+			deschedulerEvictionsCounter.Add(1, "failed")
+			klog.Errorf("Descheduler: failed to evict pod %s/%s: %v", m.Namespace, m.Name, err)
+			failed = true
+			continue
+		}
+		deschedulerDoneGauge.Set(float64(i + 1))
+		klog.Infof("Descheduler: %d of %d migrations done", i+1, len(plan.Migrations))
+		if cfg.DryRun {
+			continue
+		}
+
+		if err := c.waitForRelease(m, stopCh); err != nil {
+			klog.Warningf("Descheduler: pod %s/%s didn't release GPUs %v of node %s, abort the plan after %d of %d migrations: %v",
+				m.Namespace, m.Name, m.FromGPUs, m.From, i+1, len(plan.Migrations), err)
+			return
+		}
+		if i+1 < len(plan.Migrations) && plan.Migrations[i+1].From == m.From {
+			continue
+		}
+		if err := c.waitForIsland(m.From, plan, islandsBefore, cfg.EvictionInterval, stopCh); err != nil {
+			deschedulerRestoredCounter.Add(1, "failed")
+			klog.Warningf("Descheduler: no island of %d GPUs restored on node %s, abort the plan after %d of %d migrations: %v",
+				plan.IslandSize, m.From, i+1, len(plan.Migrations), err)
+			return
+		}
+		deschedulerRestoredCounter.Add(1, "restored")
+		klog.Infof("Descheduler: restored an island of %d GPUs on node %s", plan.IslandSize, m.From)
+	}
+}
+
+// nodeIslands counts the islands of the plan in the free GPUs of the node
+func (c *Controller) nodeIslands(name string, plan *cache.DefragPlan) int {
+	n, err := c.schedulerCache.GetNodeInfo(name)
+	if err != nil {
+		klog.Warningf("Descheduler: failed to get node %s: %v", name, err)
+		return 0
+	}
+	return n.Capacity(plan.IslandSize, plan.MinLinkQuality, c.schedulerCache.GetScoringConfig())
+}
+
+// waitForRelease waits for the evicted pod of the migration to be removed
+// from the cache, which frees its GPUs
+func (c *Controller) waitForRelease(m *cache.Migration, stopCh <-chan struct{}) error {
+	return pollUntil(func() bool {
+		return !c.schedulerCache.KnownPod(m.UID)
+	}, stopCh)
+}
+
+// waitForIsland waits for the node to have more islands than before its
+// evictions and checks they're still there after settle, in which the
+// evicted pods are rescheduled and may take the freed GPUs again
+func (c *Controller) waitForIsland(name string, plan *cache.DefragPlan, before int, settle time.Duration, stopCh <-chan struct{}) error {
+	err := pollUntil(func() bool {
+		return c.nodeIslands(name, plan) > before
+	}, stopCh)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-stopCh:
+		return fmt.Errorf("stopped")
+	case <-time.After(settle):
+	}
+	if islands := c.nodeIslands(name, plan); islands <= before {
+		return fmt.Errorf("the freed GPUs were taken again, %d islands", islands)
+	}
+	return nil
+}
+
+// pollUntil polls the condition until it's met, defragVerifyTimeout is over
+// or stopCh is closed
+func pollUntil(cond func() bool, stopCh <-chan struct{}) error {
+	return wait.PollImmediate(defragVerifyPeriod, defragVerifyTimeout, func() (bool, error) {
+		select {
+		case <-stopCh:
+			return false, fmt.Errorf("stopped")
+		default:
+		}
+		return cond(), nil
+	})
+}
+
+// evict the pod of the migration if it's still the one planned
+func (c *Controller) evict(m *cache.Migration, plan *cache.DefragPlan, dryRun bool) error {
+	pod, err := c.podLister.Pods(m.Namespace).Get(m.Name)
+	if err != nil {
+		return err
+	}
+	if pod.UID != m.UID || pod.Spec.NodeName != m.From {
+		return fmt.Errorf("pod %s/%s changed since the plan", m.Namespace, m.Name)
+	}
+
+	if dryRun {
+		deschedulerEvictionsCounter.Add(1, "dry-run")
+		klog.Infof("Descheduler (dry run): would evict pod %s/%s from GPUs %v of node %s, it fits GPUs %v of node %s",
+			m.Namespace, m.Name, m.FromGPUs, m.From, m.ToGPUs, m.To)
+		return nil
+	}
+
+	err = c.clientset.PolicyV1beta1().Evictions(m.Namespace).Evict(&policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: m.Namespace, Name: m.Name},
+	})
+	if err != nil {
+		return err
+	}
+	deschedulerEvictionsCounter.Add(1, "evicted")
+	c.recorder.Eventf(pod, v1.EventTypeNormal, EventReasonDefragmented,
+		"Evicted from GPUs %s of node %s to restore an intact island of %d GPUs, it fits GPUs %s of node %s",
+		strings.Join(m.FromGPUs, ","), m.From, plan.IslandSize, strings.Join(m.ToGPUs, ","), m.To)
+	klog.Infof("Descheduler: evicted pod %s/%s from node %s", m.Namespace, m.Name, m.From)
+	return nil
+}
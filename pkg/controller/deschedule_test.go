@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		days    []time.Weekday
+		start   time.Duration
+		end     time.Duration
+		wantErr bool
+	}{
+		{window: "01:00-05:00", start: time.Hour, end: 5 * time.Hour},
+		{window: "22:00-04:00", start: 22 * time.Hour, end: 4 * time.Hour},
+		{window: "Sat,sun 01:30-05:00", days: []time.Weekday{time.Saturday, time.Sunday}, start: 90 * time.Minute, end: 5 * time.Hour},
+		{window: "00:00-00:00"},
+		{window: "Sat", wantErr: true},
+		{window: "01:00", wantErr: true},
+		{window: "25:00-01:00", wantErr: true},
+		{window: "01:00-1:60", wantErr: true},
+		{window: "Funday 01:00-02:00", wantErr: true},
+		{window: "Sat 01:00-02:00 UTC", wantErr: true},
+	}
+	for _, test := range tests {
+		w, err := ParseMaintenanceWindow(test.window)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: got error %v, want error %v", test.window, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(w.Days) != len(test.days) || w.Start != test.start || w.End != test.end {
+			t.Errorf("%q: got %v %v-%v, want %v %v-%v", test.window, w.Days, w.Start, w.End, test.days, test.start, test.end)
+			continue
+		}
+		for i := range w.Days {
+			if w.Days[i] != test.days[i] {
+				t.Errorf("%q: got days %v, want %v", test.window, w.Days, test.days)
+				break
+			}
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	// 2026-10-17 is a Saturday
+	at := func(day int, clock string) time.Time {
+		c, err := time.Parse("15:04:05", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, 10, day, c.Hour(), c.Minute(), c.Second(), 0, time.Local)
+	}
+
+	tests := []struct {
+		window string
+		time   time.Time
+		want   bool
+	}{
+		{"01:00-05:00", at(17, "01:00:00"), true},
+		{"01:00-05:00", at(17, "04:59:59"), true},
+		{"01:00-05:00", at(17, "05:00:00"), false},
+		{"01:00-05:00", at(17, "00:59:59"), false},
+
+		{"22:00-04:00", at(19, "22:00:00"), true},
+		{"22:00-04:00", at(19, "23:30:00"), true},
+		{"22:00-04:00", at(20, "03:59:59"), true},
+		{"22:00-04:00", at(20, "04:00:00"), false},
+		{"22:00-04:00", at(19, "21:59:59"), false},
+		{"22:00-04:00", at(19, "12:00:00"), false},
+
+		// the part after midnight belongs to the window of the day before
+		{"Sat 22:00-02:00", at(17, "23:00:00"), true},
+		{"Sat 22:00-02:00", at(18, "01:00:00"), true},
+		{"Sat 22:00-02:00", at(18, "02:00:00"), false},
+		{"Sat 22:00-02:00", at(17, "01:00:00"), false},
+		{"Sat 22:00-02:00", at(18, "23:00:00"), false},
+		{"Fri,Sat 22:00-02:00", at(17, "01:00:00"), true},
+
+		// the same start and end is the whole day
+		{"00:00-00:00", at(17, "00:00:00"), true},
+		{"00:00-00:00", at(17, "12:00:00"), true},
+		{"00:00-00:00", at(17, "23:59:59"), true},
+		{"Sat 00:00-00:00", at(17, "23:59:59"), true},
+		{"Sat 00:00-00:00", at(18, "00:00:00"), false},
+		{"Sat 00:00-00:00", at(16, "23:59:59"), false},
+	}
+	for _, test := range tests {
+		w, err := ParseMaintenanceWindow(test.window)
+		if err != nil {
+			t.Fatalf("%q: %v", test.window, err)
+		}
+		if got := w.Contains(test.time); got != test.want {
+			t.Errorf("%q contains %s: got %v, want %v", test.window, test.time.Format("Mon 15:04:05"), got, test.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Healthy checks the workers are running
+func (c *Controller) Healthy() error {
+	if atomic.LoadInt32(&c.workers) == 0 {
+		return fmt.Errorf("the controller workers are not running")
+	}
+	return nil
+}
+
+// Ready checks the informers are synced and the topology of at least one
+// node is known, so the scheduler can be served
+func (c *Controller) Ready() error {
+	if err := c.Healthy(); err != nil {
+		return err
+	}
+	if !c.nodeInformerSynced() || !c.podInformerSynced() {
+		return fmt.Errorf("the informers are not synced")
+	}
+	if c.schedulerCache.KnownTopologies() == 0 {
+		return fmt.Errorf("no node GPU topology is known")
+	}
+	return nil
+}
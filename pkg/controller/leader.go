@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"github.com/gpucloud/node-topology-manager/pkg/leader"
+)
+
+// SetElector makes the controller do its writes, the taints and the
+// evictions, only while this replica is the leader. It must be called
+// before TaintDegradedNodes and Run.
+func (c *Controller) SetElector(e *leader.Elector) {
+	c.elector = e
+	e.OnChange(func(isLeader bool) {
+		if isLeader && c.taintDegraded {
+			c.syncDegradedTaints()
+		}
+	})
+}
+
+// isLeader tells whether the controller may write, it always may without
+// leader election
+func (c *Controller) isLeader() bool {
+	return c.elector == nil || c.elector.IsLeader()
+}
+
+// syncDegradedTaints catches up with the degradations seen while following
+// by queueing every node
+func (c *Controller) syncDegradedTaints() {
+	for _, n := range c.schedulerCache.Nodes() {
+		c.taintQueue.Add(n.GetName())
+	}
+}
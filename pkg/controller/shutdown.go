@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// startWrite registers an asynchronous API write, the caller calls
+// c.writes.Done once it's over. It's refused once the controller is stopping.
+func (c *Controller) startWrite() bool {
+	c.writesLock.Lock()
+	defer c.writesLock.Unlock()
+
+	if c.stopping {
+		return false
+	}
+	c.writes.Add(1)
+	return true
+}
+
+// WaitForWrites refuses the new asynchronous writes, the taints and the
+// evictions, and waits for the ones in progress until the timeout
+func (c *Controller) WaitForWrites(timeout time.Duration) error {
+	c.writesLock.Lock()
+	c.stopping = true
+	c.writesLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("the writes in progress are not done in %v", timeout)
+	}
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// TaintDegradedNodes taints the nodes with degraded GPU links and removes
+// the taint once the links are restored, only the leader does it. The
+// changes queue the node, the worker started by Run syncs the taint with
+// the degraded links in the cache at that time, so the last change wins.
+func (c *Controller) TaintDegradedNodes() {
+	c.taintDegraded = true
+	c.schedulerCache.SetDegradationHandler(func(node *v1.Node, _ []cache.DegradedLink) {
+		c.taintQueue.Add(node.Name)
+	})
+}
+
+func (c *Controller) runTaintWorker() {
+	for c.processNextTaint() {
+	}
+}
+
+// processNextTaint syncs the taint of the next node of the taint queue
+func (c *Controller) processNextTaint() bool {
+	key, quit := c.taintQueue.Get()
+	if quit {
+		return false
+	}
+	defer c.taintQueue.Done(key)
+
+	if err := c.syncDegradedTaint(key.(string)); err != nil {
+		klog.Errorf("Failed to update the taint %s of node %s: %v", utils.TaintDegradedTopology, key, err)
+		c.taintQueue.AddRateLimited(key)
+		return true
+	}
+	c.taintQueue.Forget(key)
+	return true
+}
+
+// syncDegradedTaint sets the taint of the node from its degraded links in
+// the cache, the followers leave it to the leader which syncs every node
+// when it's elected
+func (c *Controller) syncDegradedTaint(name string) error {
+	if !c.isLeader() {
+		klog.V(2).Infof("Not the leader, leave the taint %s of node %s to the leader", utils.TaintDegradedTopology, name)
+		return nil
+	}
+	if !c.startWrite() {
+		return nil
+	}
+	defer c.writes.Done()
+
+	n, err := c.schedulerCache.GetNodeInfo(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.setDegradedTaint(name, len(n.DegradedLinks()) > 0)
+}
+
+func (c *Controller) setDegradedTaint(name string, degraded bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.clientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var taints []v1.Taint
+		found := false
+		for _, t := range node.Spec.Taints {
+			if t.Key == utils.TaintDegradedTopology {
+				found = true
+				continue
+			}
+			taints = append(taints, t)
+		}
+		if found == degraded {
+			return nil
+		}
+		if degraded {
+			taints = append(taints, v1.Taint{
+				Key:    utils.TaintDegradedTopology,
+				Effect: v1.TaintEffectPreferNoSchedule,
+			})
+		}
+
+		nodeCopy := node.DeepCopy()
+		nodeCopy.Spec.Taints = taints
+		_, err = c.clientset.CoreV1().Nodes().Update(nodeCopy)
+		if err == nil {
+			klog.Infof("Set the taint %s of node %s to %v", utils.TaintDegradedTopology, name, degraded)
+		}
+		return err
+	})
+}
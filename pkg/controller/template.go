@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeinformers "k8s.io/client-go/informers"
+	clientgocache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// WatchTemplates loads the topology templates from the ConfigMap and reloads
+// them on its changes, the nodes using the templates are expanded again.
+func (c *Controller) WatchTemplates(namespace, name string, resync time.Duration, stopCh <-chan struct{}) error {
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(c.clientset, resync,
+		kubeinformers.WithNamespace(namespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.AddEventHandler(clientgocache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cm, ok := obj.(*v1.ConfigMap); ok {
+				c.syncTemplates(cm.Data)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if cm, ok := newObj.(*v1.ConfigMap); ok {
+				c.syncTemplates(cm.Data)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.syncTemplates(nil)
+		},
+	})
+	go factory.Start(stopCh)
+
+	if ok := clientgocache.WaitForCacheSync(stopCh, informer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for the template ConfigMap %s/%s to sync", namespace, name)
+	}
+	klog.Infof("info: watching the topology templates in ConfigMap %s/%s", namespace, name)
+	return nil
+}
+
+func (c *Controller) syncTemplates(data map[string]string) {
+	if err := c.schedulerCache.GetTemplates().LoadConfigMap(data); err != nil {
+		klog.Warningf("Failed to load some topology templates: %v", err)
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list node list: %v", err)
+		return
+	}
+	for _, node := range nodes {
+		r, ok := utils.GetNodeResource(node)
+		if !ok {
+			continue
+		}
+		if _, ok := node.Annotations[r.TopologyAnnotation]; ok {
+			continue
+		}
+		if err := c.schedulerCache.UpdateNodeTopology(node); err != nil {
+			klog.Warningf("Failed to update the topology of node %s: %v", node.Name, err)
+		}
+	}
+}
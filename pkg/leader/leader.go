@@ -0,0 +1,277 @@
+package leader
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// AnnotationLeaderAddress is the address the leader serves on, recorded
+	// in the Lease so the followers can forward the requests to it
+	AnnotationLeaderAddress = "gpucloud.io/leader-address"
+)
+
+// Config of the Lease based leader election
+type Config struct {
+	// Namespace and Name of the Lease
+	Namespace string
+	Name      string
+	// Identity of this replica, unique among the replicas
+	Identity string
+	// Address of this replica, e.g. http://10.0.0.1:3767, the followers
+	// forward to it. Nothing is forwarded if empty.
+	Address string
+
+	// LeaseDuration is how long the followers wait before taking over a
+	// lease which isn't renewed
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries to renew the lease before
+	// it steps down
+	RenewDeadline time.Duration
+	// RetryPeriod between two tries to acquire or renew the lease
+	RetryPeriod time.Duration
+}
+
+// Validate checks the durations leave room for the leader to step down
+// before a follower takes over
+func (c *Config) Validate() error {
+	if c.Namespace == "" || c.Name == "" || c.Identity == "" {
+		return fmt.Errorf("the lease namespace, name and identity are required")
+	}
+	if c.RetryPeriod <= 0 || c.RenewDeadline <= c.RetryPeriod || c.LeaseDuration <= c.RenewDeadline {
+		return fmt.Errorf("the lease duration %v must be longer than the renew deadline %v, which must be longer than the retry period %v",
+			c.LeaseDuration, c.RenewDeadline, c.RetryPeriod)
+	}
+	return nil
+}
+
+// Elector elects a leader among the replicas with a Lease, all the replicas
+// keep running and ask IsLeader before the writes only the leader does
+type Elector struct {
+	client kubernetes.Interface
+	config Config
+
+	lock    *sync.RWMutex
+	leader  bool
+	holder  string
+	address string
+	// observed is the lease spec seen last and when it was seen, the
+	// expiry is judged by the local clock
+	observed     coordinationv1.LeaseSpec
+	observedTime time.Time
+	renewTime    time.Time
+
+	callbacks []func(leader bool)
+}
+
+// NewElector creates the elector
+func NewElector(client kubernetes.Interface, config Config) (*Elector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Elector{
+		client: client,
+		config: config,
+		lock:   new(sync.RWMutex),
+	}, nil
+}
+
+// OnChange registers a callback notified when this replica gains or loses
+// the leadership, it must be called before Run
+func (e *Elector) OnChange(f func(leader bool)) {
+	e.callbacks = append(e.callbacks, f)
+}
+
+// IsLeader tells whether this replica is the leader
+func (e *Elector) IsLeader() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.leader
+}
+
+// Leader returns the identity and the address of the leader last observed
+func (e *Elector) Leader() (string, string) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.holder, e.address
+}
+
+// Run tries to acquire and renew the lease until stopCh is closed, the
+// lease is released on the way out so a follower takes over at once
+func (e *Elector) Run(stopCh <-chan struct{}) {
+	klog.Infof("Starting the leader election of %s with lease %s/%s", e.config.Identity, e.config.Namespace, e.config.Name)
+	wait.Until(e.tryAcquireOrRenew, e.config.RetryPeriod, stopCh)
+	e.release()
+}
+
+func (e *Elector) tryAcquireOrRenew() {
+	now := time.Now()
+	leases := e.client.CoordinationV1().Leases(e.config.Namespace)
+
+	lease, err := leases.Get(e.config.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		lease = &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: e.config.Namespace, Name: e.config.Name}}
+		e.fillLease(lease, now, true)
+		if lease, err = leases.Create(lease); err != nil {
+			e.failRenew(now, err)
+			return
+		}
+		e.observe(lease, now)
+		e.setLeader(true)
+		return
+	case err != nil:
+		e.failRenew(now, err)
+		return
+	}
+
+	e.observe(lease, now)
+	holder, _ := e.Leader()
+	if holder != "" && holder != e.config.Identity && !e.expired(now) {
+		e.setLeader(false)
+		return
+	}
+
+	leaseCopy := lease.DeepCopy()
+	e.fillLease(leaseCopy, now, holder != e.config.Identity)
+	if lease, err = leases.Update(leaseCopy); err != nil {
+		e.failRenew(now, err)
+		return
+	}
+	e.observe(lease, now)
+	e.setLeader(true)
+}
+
+// fillLease records this replica as the holder, acquiring bumps the
+// transitions
+func (e *Elector) fillLease(lease *coordinationv1.Lease, now time.Time, acquire bool) {
+	identity := e.config.Identity
+	duration := int32(e.config.LeaseDuration / time.Second)
+	renew := metav1.NewMicroTime(now)
+
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &renew
+	if acquire {
+		lease.Spec.AcquireTime = &renew
+		var transitions int32
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[AnnotationLeaderAddress] = e.config.Address
+}
+
+// observe records the lease, the observed time only moves when the holder
+// renews it
+func (e *Elector) observe(lease *coordinationv1.Lease, now time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	spec := lease.Spec
+	if !sameLeaseSpec(&spec, &e.observed) {
+		e.observed = spec
+		e.observedTime = now
+	}
+	e.holder = ""
+	if spec.HolderIdentity != nil {
+		e.holder = *spec.HolderIdentity
+	}
+	e.address = lease.Annotations[AnnotationLeaderAddress]
+	if e.holder == e.config.Identity {
+		e.renewTime = now
+	}
+}
+
+func sameLeaseSpec(a, b *coordinationv1.LeaseSpec) bool {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	micro := func(t *metav1.MicroTime) time.Time {
+		if t == nil {
+			return time.Time{}
+		}
+		return t.Time
+	}
+	return str(a.HolderIdentity) == str(b.HolderIdentity) && micro(a.RenewTime).Equal(micro(b.RenewTime))
+}
+
+func (e *Elector) expired(now time.Time) bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	duration := e.config.LeaseDuration
+	if e.observed.LeaseDurationSeconds != nil {
+		duration = time.Duration(*e.observed.LeaseDurationSeconds) * time.Second
+	}
+	return e.observedTime.Add(duration).Before(now)
+}
+
+// failRenew steps down once the lease couldn't be renewed for the renew
+// deadline
+func (e *Elector) failRenew(now time.Time, err error) {
+	klog.Warningf("Failed to acquire or renew lease %s/%s: %v", e.config.Namespace, e.config.Name, err)
+
+	e.lock.RLock()
+	deadline := e.renewTime.Add(e.config.RenewDeadline)
+	e.lock.RUnlock()
+	if now.After(deadline) {
+		e.setLeader(false)
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.lock.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	if leader {
+		klog.Infof("%s became the leader of lease %s/%s", e.config.Identity, e.config.Namespace, e.config.Name)
+	} else {
+		klog.Infof("%s stopped leading lease %s/%s", e.config.Identity, e.config.Namespace, e.config.Name)
+	}
+	for _, f := range e.callbacks {
+		f(leader)
+	}
+}
+
+// release gives up the lease if this replica holds it
+func (e *Elector) release() {
+	if !e.IsLeader() {
+		return
+	}
+	e.setLeader(false)
+
+	leases := e.client.CoordinationV1().Leases(e.config.Namespace)
+	lease, err := leases.Get(e.config.Name, metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != e.config.Identity {
+		return
+	}
+	leaseCopy := lease.DeepCopy()
+	leaseCopy.Spec.HolderIdentity = nil
+	duration := int32(1)
+	leaseCopy.Spec.LeaseDurationSeconds = &duration
+	delete(leaseCopy.Annotations, AnnotationLeaderAddress)
+	if _, err := leases.Update(leaseCopy); err != nil {
+		klog.Warningf("Failed to release lease %s/%s: %v", e.config.Namespace, e.config.Name, err)
+	}
+}
@@ -0,0 +1,254 @@
+package leader
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// fakeClient keeps a single lease in memory, the calls other than the ones
+// of the elector panic on the nil embedded interfaces
+type fakeClient struct {
+	kubernetes.Interface
+	lease *coordinationv1.Lease
+	// err fails all the calls
+	err error
+}
+
+func (c *fakeClient) CoordinationV1() coordinationv1client.CoordinationV1Interface {
+	return &fakeCoordination{client: c}
+}
+
+type fakeCoordination struct {
+	coordinationv1client.CoordinationV1Interface
+	client *fakeClient
+}
+
+func (c *fakeCoordination) Leases(namespace string) coordinationv1client.LeaseInterface {
+	return &fakeLeases{client: c.client}
+}
+
+type fakeLeases struct {
+	coordinationv1client.LeaseInterface
+	client *fakeClient
+}
+
+func (l *fakeLeases) Get(name string, options metav1.GetOptions) (*coordinationv1.Lease, error) {
+	if l.client.err != nil {
+		return nil, l.client.err
+	}
+	if l.client.lease == nil {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, name)
+	}
+	return l.client.lease.DeepCopy(), nil
+}
+
+func (l *fakeLeases) Create(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	if l.client.err != nil {
+		return nil, l.client.err
+	}
+	if l.client.lease != nil {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, lease.Name)
+	}
+	l.client.lease = lease.DeepCopy()
+	return lease.DeepCopy(), nil
+}
+
+func (l *fakeLeases) Update(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	if l.client.err != nil {
+		return nil, l.client.err
+	}
+	l.client.lease = lease.DeepCopy()
+	return lease.DeepCopy(), nil
+}
+
+func newTestElector(t *testing.T, client *fakeClient, identity string) (*Elector, *[]bool) {
+	e, err := NewElector(client, Config{
+		Namespace:     "kube-system",
+		Name:          "topo-scheduler",
+		Identity:      identity,
+		Address:       "http://" + identity + ":3767",
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []bool
+	e.OnChange(func(leader bool) { changes = append(changes, leader) })
+	return e, &changes
+}
+
+// foreignLease is held by another replica which renewed it at renew
+func foreignLease(renew time.Time) *coordinationv1.Lease {
+	holder := "other"
+	duration := int32(15)
+	renewTime := metav1.NewMicroTime(renew)
+	transitions := int32(3)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "kube-system",
+			Name:        "topo-scheduler",
+			Annotations: map[string]string{AnnotationLeaderAddress: "http://other:3767"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewTime,
+			AcquireTime:          &renewTime,
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+func holderOf(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func TestAcquireMissingLease(t *testing.T) {
+	client := &fakeClient{}
+	e, changes := newTestElector(t, client, "me")
+
+	e.tryAcquireOrRenew()
+	if !e.IsLeader() {
+		t.Fatal("got a follower, want the leader of the missing lease")
+	}
+	if got := holderOf(client.lease); got != "me" {
+		t.Errorf("got holder %q, want me", got)
+	}
+	if got := client.lease.Annotations[AnnotationLeaderAddress]; got != "http://me:3767" {
+		t.Errorf("got address %q, want http://me:3767", got)
+	}
+	if got := *client.lease.Spec.LeaseDurationSeconds; got != 15 {
+		t.Errorf("got lease duration %d, want 15", got)
+	}
+	if holder, address := e.Leader(); holder != "me" || address != "http://me:3767" {
+		t.Errorf("got leader %s at %s, want me", holder, address)
+	}
+	if fmt.Sprint(*changes) != "[true]" {
+		t.Errorf("got changes %v, want [true]", *changes)
+	}
+
+	// renewing keeps the acquire time and the transitions
+	acquired := client.lease.Spec.AcquireTime.Time
+	e.tryAcquireOrRenew()
+	if !e.IsLeader() || !client.lease.Spec.AcquireTime.Time.Equal(acquired) || *client.lease.Spec.LeaseTransitions != 0 {
+		t.Errorf("got leader %v, acquire time %v and %d transitions after the renewal, want the ones of the creation",
+			e.IsLeader(), client.lease.Spec.AcquireTime, *client.lease.Spec.LeaseTransitions)
+	}
+	if fmt.Sprint(*changes) != "[true]" {
+		t.Errorf("got changes %v, want [true]", *changes)
+	}
+}
+
+func TestForeignLease(t *testing.T) {
+	client := &fakeClient{lease: foreignLease(time.Now())}
+	e, changes := newTestElector(t, client, "me")
+
+	e.tryAcquireOrRenew()
+	if e.IsLeader() {
+		t.Fatal("took over an unexpired lease")
+	}
+	if got := holderOf(client.lease); got != "other" {
+		t.Errorf("got holder %q, want other", got)
+	}
+	if holder, address := e.Leader(); holder != "other" || address != "http://other:3767" {
+		t.Errorf("got leader %s at %s, want other", holder, address)
+	}
+
+	// the expiry is judged by the local clock since the renewal was observed
+	e.observedTime = time.Now().Add(-16 * time.Second)
+	e.tryAcquireOrRenew()
+	if !e.IsLeader() {
+		t.Fatal("didn't take over the expired lease")
+	}
+	if got := holderOf(client.lease); got != "me" {
+		t.Errorf("got holder %q, want me", got)
+	}
+	if got := *client.lease.Spec.LeaseTransitions; got != 4 {
+		t.Errorf("got %d transitions, want 4", got)
+	}
+	if fmt.Sprint(*changes) != "[true]" {
+		t.Errorf("got changes %v, want [true]", *changes)
+	}
+}
+
+func TestStepDownAfterRenewDeadline(t *testing.T) {
+	client := &fakeClient{}
+	e, changes := newTestElector(t, client, "me")
+	e.tryAcquireOrRenew()
+
+	client.err = fmt.Errorf("connection refused")
+	e.tryAcquireOrRenew()
+	if !e.IsLeader() {
+		t.Fatal("stepped down before the renew deadline")
+	}
+
+	e.renewTime = time.Now().Add(-11 * time.Second)
+	e.tryAcquireOrRenew()
+	if e.IsLeader() {
+		t.Fatal("still the leader after the renew deadline")
+	}
+	if fmt.Sprint(*changes) != "[true false]" {
+		t.Errorf("got changes %v, want [true false]", *changes)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	client := &fakeClient{}
+	e, changes := newTestElector(t, client, "me")
+	e.tryAcquireOrRenew()
+
+	e.release()
+	if e.IsLeader() {
+		t.Error("still the leader after the release")
+	}
+	if got := holderOf(client.lease); got != "" {
+		t.Errorf("got holder %q, want none", got)
+	}
+	if _, ok := client.lease.Annotations[AnnotationLeaderAddress]; ok {
+		t.Error("the released lease keeps the address")
+	}
+	if got := *client.lease.Spec.LeaseDurationSeconds; got != 1 {
+		t.Errorf("got lease duration %d, want 1", got)
+	}
+	if fmt.Sprint(*changes) != "[true false]" {
+		t.Errorf("got changes %v, want [true false]", *changes)
+	}
+
+	// a follower leaves the lease of the leader alone
+	client.lease = foreignLease(time.Now())
+	follower, _ := newTestElector(t, client, "me")
+	follower.tryAcquireOrRenew()
+	follower.release()
+	if got := holderOf(client.lease); got != "other" {
+		t.Errorf("got holder %q after the release of a follower, want other", got)
+	}
+}
+
+func TestReleasedLeaseIsTakenOver(t *testing.T) {
+	client := &fakeClient{}
+	leader, _ := newTestElector(t, client, "leader")
+	leader.tryAcquireOrRenew()
+	leader.release()
+
+	follower, _ := newTestElector(t, client, "me")
+	follower.tryAcquireOrRenew()
+	if !follower.IsLeader() {
+		t.Fatal("didn't take over the released lease")
+	}
+	if got := holderOf(client.lease); got != "me" {
+		t.Errorf("got holder %q, want me", got)
+	}
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	registryLock = new(sync.Mutex)
+	registry     []*Vec
+)
+
+// Vec is a gauge or counter metric partitioned by its labels, it's written in
+// the Prometheus text format.
+type Vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]float64
+	lock   *sync.Mutex
+}
+
+// NewGaugeVec creates and registers a gauge
+func NewGaugeVec(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, kind: "gauge", labels: labels})
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, kind: "counter", labels: labels})
+}
+
+func register(v *Vec) *Vec {
+	v.values = map[string]float64{}
+	v.lock = new(sync.Mutex)
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, v)
+	return v
+}
+
+// Set the value of the metric with the label values
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[v.key(labelValues)] = value
+}
+
+// Add the delta to the value of the metric with the label values
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[v.key(labelValues)] += delta
+}
+
+// Delete the metric with the label values
+func (v *Vec) Delete(labelValues ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.values, v.key(labelValues))
+}
+
+func (v *Vec) key(labelValues []string) string {
+	pairs := make([]string, 0, len(v.labels))
+	for i, l := range v.labels {
+		var val string
+		if i < len(labelValues) {
+			val = labelValues[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, val))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v *Vec) write(w http.ResponseWriter) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(w, "%s %v\n", v.name, v.values[k])
+		} else {
+			fmt.Fprintf(w, "%s{%s} %v\n", v.name, k, v.values[k])
+		}
+	}
+}
+
+// Handler writes all the registered metrics
+func Handler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, v := range registry {
+		v.write(w)
+	}
+}
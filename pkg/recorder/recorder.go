@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// Record is a priority call with the cache state it was scored against
+type Record struct {
+	Time      time.Time                     `json:"time"`
+	Args      schedulerapi.ExtenderArgs     `json:"args"`
+	Resources []utils.Resource              `json:"resources,omitempty"`
+	Scoring   *cache.ScoringConfig          `json:"scoring"`
+	Nodes     []*cache.NodeSnapshot         `json:"nodes"`
+	Result    schedulerapi.HostPriorityList `json:"result"`
+}
+
+// Recorder appends the records as JSON lines to a file, which is rotated to
+// path.1, path.2, ... once it's larger than maxBytes
+type Recorder struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	lock *sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRecorder opens the record file, at most maxFiles rotated files are kept
+func NewRecorder(path string, maxBytes int64, maxFiles int) (*Recorder, error) {
+	r := &Recorder{
+		path:     path,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+		lock:     new(sync.Mutex),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends the record
+func (r *Recorder) Write(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(data)) > r.maxBytes {
+		if err = r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	return err
+}
+
+func (r *Recorder) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.maxFiles > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close the record file
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.file.Close()
+}
+
+// ReadRecords decodes the records of a record file
+func ReadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	dec := json.NewDecoder(r)
+	for {
+		rec := &Record{}
+		if err := dec.Decode(rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,101 @@
+package recorder
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/scheduler"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// Diff is a node scored differently by the replay
+type Diff struct {
+	Host     string `json:"host"`
+	Recorded *int   `json:"recorded"`
+	Replayed *int   `json:"replayed"`
+}
+
+func (d Diff) String() string {
+	format := func(score *int) string {
+		if score == nil {
+			return "missing"
+		}
+		return fmt.Sprintf("%d", *score)
+	}
+	return fmt.Sprintf("%s: recorded %s, replayed %s", d.Host, format(d.Recorded), format(d.Replayed))
+}
+
+// Replay rebuilds the cache from the snapshots of the record and scores the
+// pod again, it returns the nodes scored differently. The managed resources
+// of the record are in use during the replay, so the replays must not run
+// concurrently.
+func Replay(rec *Record) (schedulerapi.HostPriorityList, []Diff, error) {
+	nodeIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{})
+	podIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{clientgocache.NamespaceIndex: clientgocache.MetaNamespaceIndexFunc})
+	// the managed resources pick the resource the pod is scored by, the
+	// records before they were recorded keep the ones of the process
+	if len(rec.Resources) > 0 {
+		resources := utils.Resources
+		utils.Resources = rec.Resources
+		defer func() { utils.Resources = resources }()
+	}
+	pcache := cache.NewSchedulerCache(corelisters.NewNodeLister(nodeIndexer), corelisters.NewPodLister(podIndexer), nil)
+	if rec.Scoring != nil {
+		pcache.SetScoringConfig(rec.Scoring)
+	}
+
+	for _, s := range rec.Nodes {
+		if err := nodeIndexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: s.Name}}); err != nil {
+			return nil, nil, err
+		}
+		if err := pcache.RestoreNode(s); err != nil {
+			return nil, nil, err
+		}
+	}
+	// the nodes unknown at the time of the call are left out of the cache
+	if rec.Args.NodeNames != nil {
+		for _, name := range *rec.Args.NodeNames {
+			if _, exists, _ := nodeIndexer.GetByKey(name); !exists {
+				nodeIndexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+			}
+		}
+	}
+
+	result := *scheduler.NewTopoSchedulerPriority("topo-replay", nil, pcache).Handler(rec.Args)
+	return result, diffPriorities(rec.Result, result), nil
+}
+
+func diffPriorities(recorded, replayed schedulerapi.HostPriorityList) []Diff {
+	scores := func(list schedulerapi.HostPriorityList) map[string]int {
+		m := make(map[string]int, len(list))
+		for _, p := range list {
+			m[p.Host] = p.Score
+		}
+		return m
+	}
+	before, after := scores(recorded), scores(replayed)
+
+	var diffs []Diff
+	for _, p := range recorded {
+		score := p.Score
+		if s, ok := after[p.Host]; !ok {
+			diffs = append(diffs, Diff{Host: p.Host, Recorded: &score})
+		} else if s != score {
+			replayedScore := s
+			diffs = append(diffs, Diff{Host: p.Host, Recorded: &score, Replayed: &replayedScore})
+		}
+	}
+	for _, p := range replayed {
+		if _, ok := before[p.Host]; !ok {
+			score := p.Score
+			diffs = append(diffs, Diff{Host: p.Host, Replayed: &score})
+		}
+	}
+	return diffs
+}
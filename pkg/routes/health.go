@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/klog"
+)
+
+// HealthChecker reports the liveness and the readiness of the server
+type HealthChecker interface {
+	// Healthy returns an error if the process should be restarted
+	Healthy() error
+	// Ready returns an error if the server can't serve the scheduler yet
+	Ready() error
+}
+
+func AddHealth(r *httprouter.Router, checker HealthChecker) {
+	r.GET("/healthz", checkHandler("healthz", checker.Healthy))
+	r.GET("/readyz", checkHandler("readyz", checker.Ready))
+}
+
+func checkHandler(name string, check func() error) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "text/plain")
+		if err := check(); err != nil {
+			klog.V(2).Infof("%s check failed: %v", name, err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	}
+}
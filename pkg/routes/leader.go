@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/leader"
+)
+
+const (
+	// forwardedHeader marks the requests forwarded to the leader, they're
+	// never forwarded twice
+	forwardedHeader = "X-Topo-Scheduler-Forwarded"
+)
+
+// LeaderOnly serves the request on the leader, a follower forwards it to the
+// leader if its address is known and refuses it otherwise
+func LeaderOnly(e *leader.Elector, h httprouter.Handle) httprouter.Handle {
+	if e == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if e.IsLeader() {
+			h(w, r, p)
+			return
+		}
+
+		holder, address := e.Leader()
+		if address == "" || r.Header.Get(forwardedHeader) != "" {
+			klog.Warningf("Refuse %s %s, this replica isn't the leader %q", r.Method, r.URL.Path, holder)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			errMsg := fmt.Sprintf("{'error':'not the leader, the leader is %q'}", holder)
+			w.Write([]byte(errMsg))
+			return
+		}
+
+		target, err := url.Parse(address)
+		if err != nil {
+			klog.Errorf("Invalid leader address %q: %v", address, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+			return
+		}
+		klog.V(2).Infof("Forward %s %s to the leader %s at %s", r.Method, r.URL.Path, holder, address)
+		r.Header.Set(forwardedHeader, "true")
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	}
+}
@@ -6,21 +6,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"k8s.io/klog"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
 
+	"github.com/gpucloud/node-topology-manager/pkg/leader"
+	"github.com/gpucloud/node-topology-manager/pkg/metrics"
+	"github.com/gpucloud/node-topology-manager/pkg/recorder"
 	"github.com/gpucloud/node-topology-manager/pkg/scheduler"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
 )
 
 const (
 	apiPrefix      = "/topo-scheduler"
 	priorityPrefix = apiPrefix + "/priority"
-)
-
-var (
-	version = "0.1.0"
+	nodesPrefix    = apiPrefix + "/nodes"
+	filterPrefix   = apiPrefix + "/filter"
+	bindPrefix     = apiPrefix + "/bind"
+	whatIfPrefix   = apiPrefix + "/whatif"
+	capacityPrefix = apiPrefix + "/capacity"
+	defragPrefix   = apiPrefix + "/defrag"
+	configPrefix   = apiPrefix + "/config"
 )
 
 func checkBody(w http.ResponseWriter, r *http.Request) {
@@ -30,7 +38,9 @@ func checkBody(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func PriorityRoute(priority *scheduler.Priority) httprouter.Handle {
+// PriorityRoute scores the nodes, every call is written to rec with the cache
+// state it was scored against unless rec is nil
+func PriorityRoute(priority *scheduler.Priority, rec *recorder.Recorder) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		checkBody(w, r)
 
@@ -45,7 +55,22 @@ func PriorityRoute(priority *scheduler.Priority) httprouter.Handle {
 			hostPriorityList = &schedulerapi.HostPriorityList{}
 		} else {
 			klog.V(2).Infof("gpu-topo-priority ExtenderArgs =%v", extenderArgs)
-			hostPriorityList = priority.Handler(extenderArgs)
+			if rec == nil {
+				hostPriorityList = priority.Handler(extenderArgs)
+			} else {
+				list, nodes, scoring := priority.RecordedHandler(extenderArgs)
+				hostPriorityList = list
+				if err := rec.Write(&recorder.Record{
+					Time:      time.Now(),
+					Args:      extenderArgs,
+					Resources: utils.Resources,
+					Scoring:   scoring,
+					Nodes:     nodes,
+					Result:    *hostPriorityList,
+				}); err != nil {
+					klog.Warningf("Failed to record the priority call: %v", err)
+				}
+			}
 		}
 
 		if resultBody, err := json.Marshal(hostPriorityList); err != nil {
@@ -63,6 +88,70 @@ func PriorityRoute(priority *scheduler.Priority) httprouter.Handle {
 	}
 }
 
+func PredicateRoute(predicate *scheduler.Predicate) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var extenderArgs schedulerapi.ExtenderArgs
+		var extenderFilterResult *schedulerapi.ExtenderFilterResult
+
+		if err := json.NewDecoder(r.Body).Decode(&extenderArgs); err != nil {
+			klog.Warningf("Failed to parse request due to error %v", err)
+			extenderFilterResult = &schedulerapi.ExtenderFilterResult{
+				Error: err.Error(),
+			}
+		} else {
+			klog.V(2).Infof("gpu-topo-filter ExtenderArgs =%v", extenderArgs)
+			extenderFilterResult = predicate.Handler(extenderArgs)
+		}
+
+		if resultBody, err := json.Marshal(extenderFilterResult); err != nil {
+			klog.Warningf("Failed due to %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+		} else {
+			klog.Info(predicate.Name, " extenderFilterResult = ", string(resultBody))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(resultBody)
+		}
+	}
+}
+
+func BindRoute(bind *scheduler.Bind) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var extenderBindingArgs schedulerapi.ExtenderBindingArgs
+		var extenderBindingResult *schedulerapi.ExtenderBindingResult
+
+		if err := json.NewDecoder(r.Body).Decode(&extenderBindingArgs); err != nil {
+			klog.Warningf("Failed to parse request due to error %v", err)
+			extenderBindingResult = &schedulerapi.ExtenderBindingResult{
+				Error: err.Error(),
+			}
+		} else {
+			klog.V(2).Infof("gpu-topo-bind ExtenderBindingArgs =%v", extenderBindingArgs)
+			extenderBindingResult = bind.Handler(extenderBindingArgs)
+		}
+
+		if resultBody, err := json.Marshal(extenderBindingResult); err != nil {
+			klog.Warningf("Failed due to %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+		} else {
+			klog.Info(bind.Name, " extenderBindingResult = ", string(resultBody))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(resultBody)
+		}
+	}
+}
+
 func DebugLogging(h httprouter.Handle, path string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		klog.Info("debug: ", path, " request body = ", r.Body)
@@ -71,10 +160,60 @@ func DebugLogging(h httprouter.Handle, path string) httprouter.Handle {
 	}
 }
 
-func AddPriority(router *httprouter.Router, priority *scheduler.Priority) {
-	router.POST(priorityPrefix, DebugLogging(PriorityRoute(priority), priorityPrefix))
+func AddPriority(router *httprouter.Router, priority *scheduler.Priority, rec *recorder.Recorder) {
+	router.POST(priorityPrefix, DebugLogging(PriorityRoute(priority, rec), priorityPrefix))
+}
+
+func AddPredicate(router *httprouter.Router, predicate *scheduler.Predicate) {
+	router.POST(filterPrefix, DebugLogging(PredicateRoute(predicate), filterPrefix))
+}
+
+// AddBind serves the binds on the leader only, elector is nil without
+// leader election
+func AddBind(router *httprouter.Router, bind *scheduler.Bind, elector *leader.Elector) {
+	router.POST(bindPrefix, DebugLogging(LeaderOnly(elector, BindRoute(bind)), bindPrefix))
+}
+
+// AddDevices serves the cordons and the evictions on the leader only,
+// elector is nil without leader election
+func AddDevices(router *httprouter.Router, s *scheduler.Priority, elector *leader.Elector) {
+	path := nodesPrefix + "/:name/devices"
+	router.GET(path, DebugLogging(s.DevicesHandler, path))
+	router.POST(path+"/:uuid/cordon", DebugLogging(LeaderOnly(elector, s.CordonHandler), path+"/cordon"))
+	router.POST(path+"/:uuid/uncordon", DebugLogging(LeaderOnly(elector, s.UncordonHandler), path+"/uncordon"))
+	router.POST(path+"/:uuid/evict", DebugLogging(LeaderOnly(elector, s.EvictHandler), path+"/evict"))
+}
+
+func AddDeviceStatus(router *httprouter.Router, s *scheduler.Priority) {
+	path := nodesPrefix + "/:name/status"
+	router.POST(path, DebugLogging(s.DeviceStatusHandler, path))
 }
 
 func AddNodeTopo(router *httprouter.Router, s *scheduler.Priority) {
 	router.POST("/nodes/:name", DebugLogging(s.NodeTopoHandler, "/nodes"))
 }
+
+func AddPreferredAllocation(router *httprouter.Router, s *scheduler.Priority) {
+	path := nodesPrefix + "/:name/preferred-allocation"
+	router.POST(path, DebugLogging(s.PreferredAllocationHandler, path))
+}
+
+func AddMetrics(router *httprouter.Router) {
+	router.GET("/metrics", metrics.Handler)
+}
+
+func AddWhatIf(router *httprouter.Router, s *scheduler.Priority) {
+	router.POST(whatIfPrefix, DebugLogging(s.WhatIfHandler, whatIfPrefix))
+}
+
+func AddCapacity(router *httprouter.Router, s *scheduler.Priority) {
+	router.GET(capacityPrefix, DebugLogging(s.CapacityHandler, capacityPrefix))
+}
+
+func AddDefrag(router *httprouter.Router, s *scheduler.Priority) {
+	router.GET(defragPrefix, DebugLogging(s.DefragHandler, defragPrefix))
+}
+
+func AddConfig(router *httprouter.Router, s *scheduler.Priority) {
+	router.GET(configPrefix, DebugLogging(s.ConfigHandler, configPrefix))
+}
@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+
+	"github.com/gpucloud/node-topology-manager/pkg/version"
 )
 
 func AddVersion(r *httprouter.Router) {
@@ -12,4 +15,8 @@ func AddVersion(r *httprouter.Router) {
 
 // handleVersion writes the server's version information.
 func handleVersion(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, _ := json.Marshal(version.Get())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
 }
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/klog"
+)
+
+// PreferredAllocationRequest is sent by the device plugin from its
+// GetPreferredAllocation call, the fields match the kubelet's request.
+type PreferredAllocationRequest struct {
+	AvailableDeviceIDs   []string `json:"availableDeviceIDs"`
+	MustIncludeDeviceIDs []string `json:"mustIncludeDeviceIDs,omitempty"`
+	AllocationSize       int      `json:"allocationSize"`
+}
+
+// PreferredAllocationResponse contains the devices chosen for the allocation
+type PreferredAllocationResponse struct {
+	DeviceIDs []string `json:"deviceIDs"`
+}
+
+// PreferredAllocationHandler chooses the best devices on the node with the
+// same subset selection used by the priority
+func (p *Priority) PreferredAllocationHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var (
+		err    error
+		code   = http.StatusInternalServerError
+		req    PreferredAllocationRequest
+		result PreferredAllocationResponse
+	)
+	defer func() {
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(code)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+			return
+		}
+		body, _ := json.Marshal(result)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}()
+
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		klog.Errorf("Failed to parse request due to error %v", err)
+		code = http.StatusBadRequest
+		return
+	}
+	name := ps.ByName("name")
+	klog.V(2).Infof("PreferredAllocationHandler: node = %s, request = %v", name, req)
+
+	node, err := p.pcache.GetNodeInfo(name)
+	if err != nil {
+		klog.Errorf("Failed to get node[%v]: %v", name, err)
+		code = http.StatusNotFound
+		return
+	}
+	result.DeviceIDs, err = node.PreferredAllocation(req.AvailableDeviceIDs, req.MustIncludeDeviceIDs, req.AllocationSize, p.pcache.GetScoringConfig())
+	if err != nil {
+		klog.Errorf("Failed to get the preferred allocation on node[%v]: %v", name, err)
+		code = http.StatusBadRequest
+	}
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// Bind is the bindVerb of the extender. The scheduler hands it the binding of
+// every pod requesting one of the managedResources of the policy, so these
+// must list all the GPU resources of the cache.
+type Bind struct {
+	Name   string
+	client kubernetes.Interface
+	pcache *cache.SchedulerCache
+	// lock serializes the allocations so that two pods never get the same GPUs
+	lock *sync.Mutex
+}
+
+// NewTopoSchedulerBind return a new bind which allocates the GPUs of the pod
+// before binding it to the node
+func NewTopoSchedulerBind(Name string, clientset kubernetes.Interface, c *cache.SchedulerCache) *Bind {
+	return &Bind{
+		Name:   Name,
+		client: clientset,
+		pcache: c,
+		lock:   new(sync.Mutex),
+	}
+}
+
+func (b *Bind) Handler(args schedulerapi.ExtenderBindingArgs) *schedulerapi.ExtenderBindingResult {
+	if err := b.bind(args); err != nil {
+		klog.Errorf("Failed to bind pod %s in ns %s to node %s: %v", args.PodName, args.PodNamespace, args.Node, err)
+		return &schedulerapi.ExtenderBindingResult{Error: err.Error()}
+	}
+	return &schedulerapi.ExtenderBindingResult{}
+}
+
+func (b *Bind) bind(args schedulerapi.ExtenderBindingArgs) error {
+	pod, err := b.client.CoreV1().Pods(args.PodNamespace).Get(args.PodName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if pod.UID != args.PodUID {
+		return fmt.Errorf("pod %s in ns %s has UID %s, expected %s", args.PodName, args.PodNamespace, pod.UID, args.PodUID)
+	}
+
+	binding := &v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID},
+		Target:     v1.ObjectReference{Kind: "Node", Name: args.Node},
+	}
+	gpuTopoNum := utils.GetGPUTopoNum(pod)
+	if gpuTopoNum > 0 {
+		if pod, err = b.allocate(pod, args.Node, gpuTopoNum); err != nil {
+			return err
+		}
+		// the API server copies the annotations of the binding to the pod,
+		// so the GPUs are recorded if and only if the pod is bound
+		resource, _ := utils.GetGPUTopoResource(pod)
+		binding.Annotations = map[string]string{resource: pod.Annotations[resource]}
+		if server, ok := pod.Annotations[utils.AnnotationParameterServer]; ok {
+			binding.Annotations[utils.AnnotationParameterServer] = server
+		}
+	}
+
+	if err = b.client.CoreV1().Pods(pod.Namespace).Bind(binding); err != nil {
+		if gpuTopoNum > 0 {
+			b.pcache.RemovePod(pod)
+		}
+		return err
+	}
+	klog.Infof("Bound pod %s in ns %s to node %s with GPUs[%s]", pod.Name, pod.Namespace, args.Node, utils.GetGPUIDFromAnnotation(pod))
+	return nil
+}
+
+// allocate chooses and assumes the GPUs in the cache, the returned pod has
+// them in the annotation for the device plugin
+func (b *Bind) allocate(pod *v1.Pod, nodeName string, gpuTopoNum int64) (*v1.Pod, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.pcache.AssumePod(pod, nodeName, gpuTopoNum, b.pcache.GetScoringConfig())
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func newTestPod(name string, gpus int64) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name: "main",
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceName(utils.DefaultResourceName()): *resource.NewQuantity(gpus, resource.DecimalSI),
+			}},
+		}}},
+	}
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name    string
+		gpus    int64
+		uid     types.UID
+		bindErr error
+		pattern string
+		// wantGPUs held by the pod in the cache and its annotation
+		wantGPUs int
+		wantErr  bool
+	}{
+		{name: "bound", gpus: 2, wantGPUs: 2},
+		{name: "parameter server", gpus: 2, pattern: utils.CommPatternParameterServer, wantGPUs: 2},
+		{name: "no GPU", gpus: 0},
+		{name: "bind failure", gpus: 2, bindErr: fmt.Errorf("boom"), wantErr: true},
+		{name: "too many GPUs", gpus: 5, wantErr: true},
+		{name: "other pod", gpus: 2, uid: "other", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pcache := newTestCache(4, "node")
+			client := newFakeClient()
+			client.bindErr = test.bindErr
+			pod := newTestPod("pod", test.gpus)
+			if test.pattern != "" {
+				pod.Annotations = map[string]string{utils.AnnotationCommPattern: test.pattern}
+			}
+			client.pods["default/pod"] = pod
+
+			uid := pod.UID
+			if test.uid != "" {
+				uid = test.uid
+			}
+			result := NewTopoSchedulerBind("test", client, pcache).Handler(schedulerapi.ExtenderBindingArgs{
+				PodName: pod.Name, PodNamespace: pod.Namespace, PodUID: uid, Node: "node",
+			})
+			if (result.Error != "") != test.wantErr {
+				t.Fatalf("got error %q, want error %v", result.Error, test.wantErr)
+			}
+			if client.updates != 0 {
+				t.Errorf("got %d pod updates, want the GPUs only in the binding", client.updates)
+			}
+
+			n, err := pcache.GetNodeInfo("node")
+			if err != nil {
+				t.Fatal(err)
+			}
+			held := 0
+			for _, s := range n.DeviceStates() {
+				if s.Pod != "" {
+					held++
+				}
+			}
+			if held != test.wantGPUs {
+				t.Errorf("got %d GPUs held in the cache, want %d", held, test.wantGPUs)
+			}
+
+			bound := client.pods["default/pod"]
+			var annotated []string
+			if val := bound.Annotations[utils.DefaultResourceName()]; val != "" {
+				annotated = strings.Split(val, ",")
+			}
+			if len(annotated) != test.wantGPUs {
+				t.Errorf("got GPUs %v in the annotation, want %d", annotated, test.wantGPUs)
+			}
+			server, ok := bound.Annotations[utils.AnnotationParameterServer]
+			if wantServer := test.pattern == utils.CommPatternParameterServer; ok != wantServer {
+				t.Errorf("got parameter server %q, want annotated %v", server, wantServer)
+			} else if ok && (len(annotated) == 0 || server != annotated[0]) {
+				t.Errorf("got parameter server %q, want the first of %v", server, annotated)
+			}
+			if wantNode := !test.wantErr; (bound.Spec.NodeName == "node") != wantNode {
+				t.Errorf("got node %q, want bound %v", bound.Spec.NodeName, wantNode)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// CapacityHandler reports how many GPU sets of each size and of a minimum
+// link quality can still be placed, e.g.
+// GET /topo-scheduler/capacity?resource=nvidia.com/gpu-topo&sizes=1,2,4,8&minLinkQuality=50&output=table
+// The resource is the default one if it's left out.
+func (p *Priority) CapacityHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+
+	resource := utils.DefaultResourceName()
+	if value := query.Get("resource"); value != "" {
+		if _, ok := utils.GetResource(value); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unmanaged resource %q", value))
+			return
+		}
+		resource = value
+	}
+
+	sizes := cache.DefaultCapacitySizes
+	if value := query.Get("sizes"); value != "" {
+		sizes = nil
+		for _, s := range strings.Split(value, ",") {
+			size, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || size <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid size %q", s))
+				return
+			}
+			sizes = append(sizes, size)
+		}
+	}
+
+	minLinkQuality, err := queryInt(query, "minLinkQuality", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	report := p.pcache.CapacityReport(resource, sizes, minLinkQuality)
+	klog.V(2).Infof("CapacityHandler: resource = %s, sizes = %v, minLinkQuality = %d, totals = %v", resource, sizes, minLinkQuality, report.Totals)
+
+	if query.Get("output") == "table" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		report.WriteTable(w)
+		return
+	}
+	writeJSON(w, report)
+}
@@ -0,0 +1,13 @@
+package scheduler
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ConfigHandler writes the reloadable configuration in use and its version,
+// e.g. GET /topo-scheduler/config
+func (p *Priority) ConfigHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	writeJSON(w, p.pcache.ActiveConfig())
+}
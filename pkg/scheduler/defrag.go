@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+)
+
+// DefragHandler proposes the pod migrations which restore intact GPU
+// islands, nothing is evicted, e.g.
+// GET /topo-scheduler/defrag?islandSize=8&minLinkQuality=0&maxMigrations=10&maxPriority=1000
+func (p *Priority) DefragHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	opts := &cache.DefragOptions{}
+
+	var err error
+	if opts.IslandSize, err = queryInt(query, "islandSize", 8); err == nil && opts.IslandSize <= 0 {
+		err = fmt.Errorf("invalid islandSize %d", opts.IslandSize)
+	}
+	if err == nil {
+		opts.MinLinkQuality, err = queryInt(query, "minLinkQuality", 0)
+	}
+	if err == nil {
+		opts.MaxMigrations, err = queryInt(query, "maxMigrations", 10)
+	}
+	if err == nil && query.Get("maxPriority") != "" {
+		var priority int
+		if priority, err = queryInt(query, "maxPriority", 0); err == nil {
+			maxPriority := int32(priority)
+			opts.MaxPriority = &maxPriority
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if p.client != nil {
+		pdbs, err := p.client.PolicyV1beta1().PodDisruptionBudgets(metav1.NamespaceAll).List(metav1.ListOptions{})
+		if err != nil {
+			klog.Errorf("Failed to list the pod disruption budgets: %v", err)
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for i := range pdbs.Items {
+			opts.PDBs = append(opts.PDBs, &pdbs.Items[i])
+		}
+	}
+
+	plan := p.pcache.DefragPlan(opts)
+	klog.V(2).Infof("DefragHandler: %d migrations restore %d islands of %d GPUs", len(plan.Migrations), plan.IslandsAfter-plan.IslandsBefore, plan.IslandSize)
+	writeJSON(w, plan)
+}
+
+func queryInt(query url.Values, key string, def int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return i, nil
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// DevicesHandler lists the scheduling state of the GPUs on the node
+func (p *Priority) DevicesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	node, err := p.pcache.GetNodeInfo(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, node.DeviceStates())
+}
+
+// CordonHandler takes the GPU out of service
+func (p *Priority) CordonHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p.handleCordon(w, ps.ByName("name"), ps.ByName("uuid"), true)
+}
+
+// UncordonHandler puts the GPU back into service
+func (p *Priority) UncordonHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p.handleCordon(w, ps.ByName("name"), ps.ByName("uuid"), false)
+}
+
+func (p *Priority) handleCordon(w http.ResponseWriter, name, uuid string, cordon bool) {
+	klog.V(2).Infof("Set the cordon of GPU %s on node %s to %v", uuid, name, cordon)
+	if err := p.setDeviceCordon(name, uuid, cordon); err != nil {
+		klog.Errorf("Failed to set the cordon of GPU %s on node %s: %v", uuid, name, err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	node, err := p.pcache.GetNodeInfo(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, node.DeviceStates())
+}
+
+// setDeviceCordon records the cordoned GPU in the node annotation, so it
+// survives the restarts, and applies it to the cache at once
+func (p *Priority) setDeviceCordon(name, uuid string, cordon bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := p.client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var uuids []string
+		found := false
+		for _, u := range cache.ParseCordonedDevices(node) {
+			if u == uuid {
+				found = true
+				continue
+			}
+			uuids = append(uuids, u)
+		}
+		if found == cordon {
+			return nil
+		}
+		if cordon {
+			uuids = append(uuids, uuid)
+		}
+
+		nodeCopy := node.DeepCopy()
+		if nodeCopy.Annotations == nil {
+			nodeCopy.Annotations = map[string]string{}
+		}
+		if len(uuids) > 0 {
+			nodeCopy.Annotations[utils.AnnotationCordonedDevices] = cache.FormatCordonedDevices(uuids)
+		} else {
+			delete(nodeCopy.Annotations, utils.AnnotationCordonedDevices)
+		}
+		if nodeCopy, err = p.client.CoreV1().Nodes().Update(nodeCopy); err != nil {
+			return err
+		}
+		return p.pcache.UpdateCordonedDevices(nodeCopy)
+	})
+}
+
+// EvictHandler evicts the pod holding the GPU through the Eviction API, so
+// the PodDisruptionBudgets are respected
+func (p *Priority) EvictHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name, uuid := ps.ByName("name"), ps.ByName("uuid")
+	node, err := p.pcache.GetNodeInfo(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	pod := node.GetDevicePod(uuid)
+	if pod == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no pod holds GPU %s on node %s", uuid, name))
+		return
+	}
+
+	eviction := &policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	if err = p.client.CoreV1().Pods(pod.Namespace).Evict(eviction); err != nil {
+		klog.Errorf("Failed to evict pod %s in ns %s holding GPU %s: %v", pod.Name, pod.Namespace, uuid, err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	klog.Infof("Evicted pod %s in ns %s holding GPU %s on node %s", pod.Name, pod.Namespace, uuid, name)
+	writeJSON(w, node.DeviceStates())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	errMsg := fmt.Sprintf("{'error':'%v'}", err)
+	w.Write([]byte(errMsg))
+}
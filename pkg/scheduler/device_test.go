@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+func TestCordonHandlers(t *testing.T) {
+	pcache := newTestCache(4, "node")
+	client := newFakeClient()
+	client.nodes["node"] = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	p := NewTopoSchedulerPriority("test", client, pcache)
+
+	steps := []struct {
+		name   string
+		cordon bool
+		uuid   string
+		// want is the node annotation after the step
+		want string
+	}{
+		{name: "cordon", cordon: true, uuid: testUUID(2), want: testUUID(2)},
+		{name: "cordon again", cordon: true, uuid: testUUID(2), want: testUUID(2)},
+		{name: "cordon another", cordon: true, uuid: testUUID(0), want: testUUID(0) + "," + testUUID(2)},
+		{name: "uncordon", uuid: testUUID(2), want: testUUID(0)},
+		{name: "uncordon the last", uuid: testUUID(0)},
+		{name: "uncordon again", uuid: testUUID(0)},
+	}
+	for _, step := range steps {
+		ps := httprouter.Params{{Key: "name", Value: "node"}, {Key: "uuid", Value: step.uuid}}
+		w := httptest.NewRecorder()
+		if step.cordon {
+			p.CordonHandler(w, nil, ps)
+		} else {
+			p.UncordonHandler(w, nil, ps)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", step.name, w.Code, w.Body)
+		}
+
+		annotations := client.nodes["node"].Annotations
+		if got, ok := annotations[utils.AnnotationCordonedDevices]; got != step.want || ok != (step.want != "") {
+			t.Errorf("%s: got annotation %q (set %v), want %q", step.name, got, ok, step.want)
+		}
+
+		n, err := pcache.GetNodeInfo("node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cordoned := ""
+		for _, s := range n.DeviceStates() {
+			if s.Cordoned {
+				if cordoned != "" {
+					cordoned += ","
+				}
+				cordoned += s.UUID
+			}
+		}
+		if cordoned != step.want {
+			t.Errorf("%s: got cordoned GPUs %q in the cache, want %q", step.name, cordoned, step.want)
+		}
+	}
+}
+
+func TestCordonUnknownNode(t *testing.T) {
+	p := NewTopoSchedulerPriority("test", newFakeClient(), newTestCache(4, "node"))
+	w := httptest.NewRecorder()
+	p.CordonHandler(w, nil, httprouter.Params{{Key: "name", Value: "missing"}, {Key: "uuid", Value: testUUID(0)}})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
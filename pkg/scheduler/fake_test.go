@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// fakeClient keeps the nodes and the pods in memory and implements only the
+// calls of the handlers, the others panic on the nil embedded interfaces
+type fakeClient struct {
+	kubernetes.Interface
+
+	lock  sync.Mutex
+	nodes map[string]*v1.Node
+	pods  map[string]*v1.Pod
+	// bindErr fails the bindings
+	bindErr error
+	// updates counts the pod updates
+	updates int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{nodes: map[string]*v1.Node{}, pods: map[string]*v1.Pod{}}
+}
+
+func (c *fakeClient) CoreV1() corev1client.CoreV1Interface {
+	return &fakeCoreV1{client: c}
+}
+
+type fakeCoreV1 struct {
+	corev1client.CoreV1Interface
+	client *fakeClient
+}
+
+func (c *fakeCoreV1) Nodes() corev1client.NodeInterface {
+	return &fakeNodes{client: c.client}
+}
+
+func (c *fakeCoreV1) Pods(namespace string) corev1client.PodInterface {
+	return &fakePods{client: c.client, namespace: namespace}
+}
+
+type fakeNodes struct {
+	corev1client.NodeInterface
+	client *fakeClient
+}
+
+func (n *fakeNodes) Get(name string, options metav1.GetOptions) (*v1.Node, error) {
+	n.client.lock.Lock()
+	defer n.client.lock.Unlock()
+	node, ok := n.client.nodes[name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "nodes"}, name)
+	}
+	return node.DeepCopy(), nil
+}
+
+func (n *fakeNodes) Update(node *v1.Node) (*v1.Node, error) {
+	n.client.lock.Lock()
+	defer n.client.lock.Unlock()
+	if _, ok := n.client.nodes[node.Name]; !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "nodes"}, node.Name)
+	}
+	n.client.nodes[node.Name] = node.DeepCopy()
+	return node.DeepCopy(), nil
+}
+
+type fakePods struct {
+	corev1client.PodInterface
+	client    *fakeClient
+	namespace string
+}
+
+func (p *fakePods) Get(name string, options metav1.GetOptions) (*v1.Pod, error) {
+	p.client.lock.Lock()
+	defer p.client.lock.Unlock()
+	pod, ok := p.client.pods[p.namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+	}
+	return pod.DeepCopy(), nil
+}
+
+func (p *fakePods) Update(pod *v1.Pod) (*v1.Pod, error) {
+	p.client.lock.Lock()
+	defer p.client.lock.Unlock()
+	p.client.updates++
+	p.client.pods[p.namespace+"/"+pod.Name] = pod.DeepCopy()
+	return pod.DeepCopy(), nil
+}
+
+// Bind sets the node and copies the annotations of the binding to the pod
+// like the API server
+func (p *fakePods) Bind(binding *v1.Binding) error {
+	p.client.lock.Lock()
+	defer p.client.lock.Unlock()
+	if p.client.bindErr != nil {
+		return p.client.bindErr
+	}
+	pod, ok := p.client.pods[p.namespace+"/"+binding.Name]
+	if !ok {
+		return errors.NewNotFound(schema.GroupResource{Resource: "pods"}, binding.Name)
+	}
+	if pod.Spec.NodeName != "" {
+		return errors.NewConflict(schema.GroupResource{Resource: "pods"}, binding.Name, fmt.Errorf("pod is already assigned to node %s", pod.Spec.NodeName))
+	}
+	pod.Spec.NodeName = binding.Target.Name
+	for k, v := range binding.Annotations {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[k] = v
+	}
+	return nil
+}
+
+// newTestCache caches the nodes with gpus GPUs of the default resource, all
+// linked by NVLinks
+func newTestCache(gpus int, names ...string) *cache.SchedulerCache {
+	nodeIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{})
+	podIndexer := clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{clientgocache.NamespaceIndex: clientgocache.MetaNamespaceIndexFunc})
+	c := cache.NewSchedulerCache(corelisters.NewNodeLister(nodeIndexer), corelisters.NewPodLister(podIndexer), nil)
+	for _, name := range names {
+		nodeIndexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		if err := c.AddOrUpdateNode(name, utils.DefaultResourceName(), newTestTopology(gpus)); err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+func newTestTopology(gpus int) *cache.Topology {
+	t := &cache.Topology{}
+	for i := 0; i < gpus; i++ {
+		t.GPUDevice = append(t.GPUDevice, &cache.Device{
+			UUID: testUUID(i),
+			PCI:  cache.PCIInfo{BusID: fmt.Sprintf("00000000:%02X:00.0", 0x30+i)},
+		})
+	}
+	for i, d := range t.GPUDevice {
+		for j, peer := range t.GPUDevice {
+			if i != j {
+				d.Topology = append(d.Topology, cache.P2PLink{BusID: peer.PCI.BusID, Link: cache.NVLinks(2)})
+			}
+		}
+	}
+	return t
+}
+
+func testUUID(i int) string {
+	return fmt.Sprintf("GPU-%08x", i)
+}
@@ -3,18 +3,34 @@ package scheduler
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
 
 	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
 )
 
+// TopologyError is a single validation error of the topology payload
+type TopologyError struct {
+	Field  string `json:"field"`
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TopologyErrorList is returned with 422 for an invalid topology payload
+type TopologyErrorList struct {
+	Errors []TopologyError `json:"errors"`
+}
+
 func (p *Priority) NodeTopoHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var (
-		err error
-		t   cache.Topology
+		err  error
+		body []byte
+		t    *cache.Topology
 	)
 	defer func() {
 		if err != nil {
@@ -25,20 +41,82 @@ func (p *Priority) NodeTopoHandler(w http.ResponseWriter, r *http.Request, ps ht
 		}
 	}()
 
-	if err = json.NewDecoder(r.Body).Decode(&t); err != nil {
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		klog.Errorf("Failed to read request due to error %v", err)
+		return
+	}
+	// both the v1alpha1 and v1beta1 topology are accepted
+	if t, err = cache.DecodeTopology(body); err != nil {
 		klog.Errorf("Failed to parse request due to error %v", err)
 		return
 	}
 	klog.V(2).Infof("NodeTopoHandler: Topology = %v", t)
 
+	var name string = ps.ByName("name")
+	if errs := cache.ValidateTopology(t); len(errs) > 0 {
+		klog.Errorf("Node[%v]'s topology is invalid: %v", name, errs.ToAggregate())
+		writeValidationErrors(w, errs)
+		return
+	}
+
 	if p.pcache == nil {
 		klog.Errorf("Priority's cache is nil")
 		return
 	}
-	var name string = ps.ByName("name")
-	err = p.pcache.AddOrUpdateNode(name, &t)
+	// the GPUs are of the default managed resource unless the query tells
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		resource = utils.DefaultResourceName()
+	} else if _, ok := utils.GetResource(resource); !ok {
+		err = fmt.Errorf("unknown resource %q", resource)
+		return
+	}
+	err = p.pcache.AddOrUpdateNode(name, resource, t)
 	if err != nil {
 		klog.Errorf("Failed to AddOrUpdatePod with node[%v]: %v", name, err)
 	}
 	return
 }
+
+func writeValidationErrors(w http.ResponseWriter, errs field.ErrorList) {
+	result := TopologyErrorList{Errors: make([]TopologyError, 0, len(errs))}
+	for _, e := range errs {
+		result.Errors = append(result.Errors, TopologyError{
+			Field:  e.Field,
+			Type:   string(e.Type),
+			Detail: e.ErrorBody(),
+		})
+	}
+	body, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(body)
+}
+
+// DeviceStatusHandler stores the DeviceStatus of the GPUs reported by the
+// agent, the body is a map from the GPU UUID to its status
+func (p *Priority) DeviceStatusHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var (
+		err    error
+		status map[string]*cache.DeviceStatus
+	)
+	defer func() {
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+		}
+	}()
+
+	if err = json.NewDecoder(r.Body).Decode(&status); err != nil {
+		klog.Errorf("Failed to parse request due to error %v", err)
+		return
+	}
+
+	var name string = ps.ByName("name")
+	klog.V(2).Infof("DeviceStatusHandler: node = %s, status of %d GPUs", name, len(status))
+	if err = p.pcache.UpdateDeviceStatus(name, status); err != nil {
+		klog.Errorf("Failed to update the device status of node[%v]: %v", name, err)
+	}
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"k8s.io/klog"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+type Predicate struct {
+	Name   string
+	pcache *cache.SchedulerCache
+}
+
+// NewTopoSchedulerPredicate return a new predicate which filters out the
+// nodes without enough schedulable GPUs
+func NewTopoSchedulerPredicate(Name string, c *cache.SchedulerCache) *Predicate {
+	return &Predicate{
+		Name:   Name,
+		pcache: c,
+	}
+}
+
+func (p *Predicate) Handler(args schedulerapi.ExtenderArgs) *schedulerapi.ExtenderFilterResult {
+	pod := args.Pod
+	nodeNames := *args.NodeNames
+	result := &schedulerapi.ExtenderFilterResult{
+		NodeNames:   &[]string{},
+		FailedNodes: schedulerapi.FailedNodesMap{},
+	}
+
+	resource, gpuTopoNum := utils.GetGPUTopoResource(pod)
+
+	for _, nodeName := range nodeNames {
+		node, err := p.pcache.GetNodeInfo(nodeName)
+		if err != nil {
+			klog.Errorf("Failed to get node[%s]: %v", nodeName, err)
+			result.FailedNodes[nodeName] = err.Error()
+			continue
+		}
+		if fits, reason := node.Fits(resource, gpuTopoNum); !fits {
+			result.FailedNodes[nodeName] = reason
+			continue
+		}
+		*result.NodeNames = append(*result.NodeNames, nodeName)
+	}
+
+	return result
+}
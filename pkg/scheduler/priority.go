@@ -12,12 +12,12 @@ import (
 
 type Priority struct {
 	Name   string
-	client *kubernetes.Clientset
+	client kubernetes.Interface
 	pcache *cache.SchedulerCache
 }
 
 // NewTopoSchedulerPriority return a new priority scheduler
-func NewTopoSchedulerPriority(Name string, clientset *kubernetes.Clientset, c *cache.SchedulerCache) *Priority {
+func NewTopoSchedulerPriority(Name string, clientset kubernetes.Interface, c *cache.SchedulerCache) *Priority {
 	return &Priority{
 		Name:   Name,
 		client: clientset,
@@ -26,29 +26,66 @@ func NewTopoSchedulerPriority(Name string, clientset *kubernetes.Clientset, c *c
 }
 
 func (p *Priority) Handler(args schedulerapi.ExtenderArgs) *schedulerapi.HostPriorityList {
+	return p.score(args, p.pcache.GetScoringConfig(), p.pcache.GetNodeInfo)
+}
+
+// RecordedHandler scores the nodes like Handler, against the snapshots of
+// the nodes and the scoring config it returns, so the record of the call
+// is the state it was scored against
+func (p *Priority) RecordedHandler(args schedulerapi.ExtenderArgs) (*schedulerapi.HostPriorityList, []*cache.NodeSnapshot, *cache.ScoringConfig) {
+	nodes, cfg := p.Snapshot(args)
+	snapshots := make(map[string]*cache.NodeInfo, len(nodes))
+	for _, s := range nodes {
+		snapshots[s.Name] = s.NodeInfo()
+	}
+	getNodeInfo := func(name string) (*cache.NodeInfo, error) {
+		if n, ok := snapshots[name]; ok {
+			return n, nil
+		}
+		return p.pcache.GetNodeInfo(name)
+	}
+	return p.score(args, cfg, getNodeInfo), nodes, cfg
+}
+
+// score the nodes of args with cfg, the NodeInfos are looked up by getNodeInfo
+func (p *Priority) score(args schedulerapi.ExtenderArgs, cfg *cache.ScoringConfig, getNodeInfo func(string) (*cache.NodeInfo, error)) *schedulerapi.HostPriorityList {
 	pod := args.Pod
 	nodeNames := *args.NodeNames
 	result := schedulerapi.HostPriorityList{}
 
-	gpuTopoNum := utils.GetGPUTopoNum(pod)
+	// the pod is scored on the nodes of the resource it requests, with the
+	// score table of the resource
+	resource, gpuTopoNum := utils.GetGPUTopoResource(pod)
 
 	for _, nodeName := range nodeNames {
-		score, err := p.makeScore(pod, nodeName, gpuTopoNum)
+		node, err := getNodeInfo(nodeName)
 		if err != nil {
 			klog.Errorf("Failed to count the score of node[%s]: %v", nodeName, err)
 			continue
 		}
-		result = append(result, schedulerapi.HostPriority{nodeName, score})
+		score, err := makeScore(pod, node, resource, gpuTopoNum, cfg)
+		if err != nil {
+			klog.Errorf("Failed to count the score of node[%s]: %v", nodeName, err)
+			continue
+		}
+		result = append(result, schedulerapi.HostPriority{Host: nodeName, Score: score})
 	}
 
 	return &result
 }
 
-func (p *Priority) makeScore(pod *v1.Pod, nodeName string, num int64) (int, error) {
-	node, err := p.pcache.GetNodeInfo(nodeName)
-	if err != nil {
-		return -1, err
+func makeScore(pod *v1.Pod, node *cache.NodeInfo, resource string, num int64, cfg *cache.ScoringConfig) (int, error) {
+	if num > 0 && node.Resource() != resource {
+		return 0, nil
 	}
 
-	return node.MakeScore(pod, num)
+	return node.MakeScore(pod, num, cfg)
+}
+
+// Snapshot copies the cache state the pod of args would be scored against
+func (p *Priority) Snapshot(args schedulerapi.ExtenderArgs) ([]*cache.NodeSnapshot, *cache.ScoringConfig) {
+	if args.NodeNames == nil {
+		return nil, p.pcache.GetScoringConfig()
+	}
+	return p.pcache.SnapshotNodes(*args.NodeNames), p.pcache.GetScoringConfig()
 }
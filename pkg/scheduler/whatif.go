@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+// WhatIfRequest describes a hypothetical pod, either by its spec or by the
+// number of GPUs of the resource, the placement strategy and the
+// communication pattern
+type WhatIfRequest struct {
+	Pod  *v1.Pod `json:"pod,omitempty"`
+	GPUs int64   `json:"gpus,omitempty"`
+	// Resource of the GPUs, the default managed resource if empty
+	Resource string `json:"resource,omitempty"`
+	Strategy string `json:"strategy,omitempty"`
+	// Pattern is the communication pattern, see utils.AnnotationCommPattern
+	Pattern string `json:"pattern,omitempty"`
+	// Nodes limits the candidate nodes, all the cached nodes if empty
+	Nodes []string `json:"nodes,omitempty"`
+	// MinLinkQuality drops the nodes whose GPU set has a lower link score
+	// in [0, 100] for the communication pattern
+	MinLinkQuality int `json:"minLinkQuality,omitempty"`
+}
+
+// WhatIfResponse contains the ranked nodes which could hold the pod now
+type WhatIfResponse struct {
+	Resource string             `json:"resource"`
+	GPUs     int64              `json:"gpus"`
+	Nodes    []*cache.Placement `json:"nodes"`
+}
+
+// WhatIfHandler ranks the nodes for a hypothetical pod with the GPUs which
+// would be chosen on each, nothing is allocated
+func (p *Priority) WhatIfHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var (
+		err    error
+		code   = http.StatusInternalServerError
+		req    WhatIfRequest
+		result WhatIfResponse
+	)
+	defer func() {
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(code)
+			errMsg := fmt.Sprintf("{'error':'%v'}", err)
+			w.Write([]byte(errMsg))
+			return
+		}
+		body, _ := json.Marshal(result)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}()
+
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		klog.Errorf("Failed to parse request due to error %v", err)
+		code = http.StatusBadRequest
+		return
+	}
+	pod := req.Pod
+	if pod == nil {
+		if req.Resource == "" {
+			req.Resource = utils.DefaultResourceName()
+		}
+		pod = newWhatIfPod(req.Resource, req.GPUs, req.Strategy, req.Pattern)
+	}
+	result.Resource, result.GPUs = utils.GetGPUTopoResource(pod)
+	if result.GPUs <= 0 {
+		err = fmt.Errorf("the pod requests no managed resource")
+		code = http.StatusBadRequest
+		return
+	}
+	klog.V(2).Infof("WhatIfHandler: gpus = %d, request = %v", result.GPUs, req)
+
+	result.Nodes, err = p.pcache.WhatIf(pod, result.Resource, result.GPUs, req.Nodes, req.MinLinkQuality)
+	if err != nil {
+		klog.Errorf("Failed to place the what-if pod: %v", err)
+	}
+}
+
+func newWhatIfPod(resourceName string, gpus int64, strategy, pattern string) *v1.Pod {
+	pod := &v1.Pod{}
+	pod.Name = "whatif"
+	pod.Annotations = map[string]string{}
+	if strategy != "" {
+		pod.Annotations[utils.AnnotationPlacementStrategy] = strategy
+	}
+	if pattern != "" {
+		pod.Annotations[utils.AnnotationCommPattern] = pattern
+	}
+	pod.Spec.Containers = []v1.Container{{
+		Name: "whatif",
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{
+				v1.ResourceName(resourceName): *resource.NewQuantity(gpus, resource.DecimalSI),
+			},
+		},
+	}}
+	return pod
+}
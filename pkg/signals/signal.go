@@ -25,3 +25,25 @@ func SetupSignalHandler() (stopCh <-chan struct{}) {
 
 	return stop
 }
+
+// SetupReloadHandler registered for SIGHUP. A value is sent on the returned
+// channel for each of them, the signals caught while the last one is pending
+// are coalesced. Nothing is sent on the platforms without SIGHUP.
+func SetupReloadHandler() <-chan struct{} {
+	reload := make(chan struct{}, 1)
+	if len(reloadSignals) == 0 {
+		return reload
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, reloadSignals...)
+	go func() {
+		for range c {
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return reload
+}
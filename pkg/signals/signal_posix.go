@@ -1,3 +1,4 @@
+//go:build !windows
 // +build !windows
 
 package signals
@@ -8,3 +9,5 @@ import (
 )
 
 var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,31 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTable writes the report as an aligned table
+func (r *Report) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	rows := []struct {
+		name  string
+		value string
+	}{
+		{"Jobs", fmt.Sprintf("%d", r.Jobs)},
+		{"Placed", fmt.Sprintf("%d", r.Placed)},
+		{"Unplaced", fmt.Sprintf("%d", r.Unplaced)},
+		{"Total GPUs", fmt.Sprintf("%d", r.TotalGPUs)},
+		{"Makespan (s)", fmt.Sprintf("%.0f", r.Makespan)},
+		{"GPU utilization", fmt.Sprintf("%.1f%%", r.GPUUtilization*100)},
+		{"Average link quality", fmt.Sprintf("%.1f", r.AverageLinkQuality)},
+		{"Average wait (s)", fmt.Sprintf("%.1f", r.AverageWait)},
+		{"Max wait (s)", fmt.Sprintf("%.1f", r.MaxWait)},
+		{fmt.Sprintf("%d-GPU island available", r.IslandSize), fmt.Sprintf("%.1f%%", r.IslandAvailability*100)},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\n", row.name, row.value)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,323 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/scheduler"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	simNamespace = "topo-sim"
+)
+
+// Simulator replays a workload through the extender's filter, priority and
+// bind logic over a SchedulerCache built from fake listers
+type Simulator struct {
+	nodeIndexer clientgocache.Indexer
+	podIndexer  clientgocache.Indexer
+	pcache      *cache.SchedulerCache
+	predicate   *scheduler.Predicate
+	priority    *scheduler.Priority
+
+	nodeNames  []string
+	totalGPUs  int
+	islandSize int
+}
+
+type event struct {
+	time      float64
+	departure bool
+	job       *Job
+}
+
+// jobState tracks a job during the simulation
+type jobState struct {
+	job   *Job
+	pod   *v1.Pod
+	start float64
+}
+
+// New builds the cluster, the topology files are relative to baseDir
+func New(cluster *Cluster, baseDir string, islandSize int) (*Simulator, error) {
+	s := &Simulator{
+		nodeIndexer: clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{}),
+		podIndexer:  clientgocache.NewIndexer(clientgocache.MetaNamespaceKeyFunc, clientgocache.Indexers{clientgocache.NamespaceIndex: clientgocache.MetaNamespaceIndexFunc}),
+		islandSize:  islandSize,
+	}
+	s.pcache = cache.NewSchedulerCache(corelisters.NewNodeLister(s.nodeIndexer), corelisters.NewPodLister(s.podIndexer), nil)
+	if cluster.Scoring != nil {
+		s.pcache.SetScoringConfig(cluster.Scoring)
+	}
+	s.predicate = scheduler.NewTopoSchedulerPredicate("topo-sim", s.pcache)
+	s.priority = scheduler.NewTopoSchedulerPriority("topo-sim", nil, s.pcache)
+
+	for _, spec := range cluster.Nodes {
+		annotations, err := s.nodeAnnotations(&spec, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", spec.Name, err)
+		}
+		count := spec.Count
+		if count <= 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			name := spec.Name
+			if count > 1 {
+				name = fmt.Sprintf("%s-%d", spec.Name, i)
+			}
+			if err := s.addNode(name, annotations(name)); err != nil {
+				return nil, fmt.Errorf("node %s: %v", name, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// nodeAnnotations returns the builder of the topology annotations of the nodes
+func (s *Simulator) nodeAnnotations(spec *NodeSpec, baseDir string) (func(name string) map[string]string, error) {
+	switch {
+	case spec.Template != "":
+		tmpl, ok := s.pcache.GetTemplates().Get(spec.Template)
+		if !ok {
+			return nil, fmt.Errorf("unknown template %q", spec.Template)
+		}
+		return func(name string) map[string]string {
+			ref := cache.TemplateRef{Model: spec.Template}
+			for i := range tmpl.LinkMatrix {
+				ref.UUIDs = append(ref.UUIDs, fmt.Sprintf("GPU-%s-%d", name, i))
+			}
+			val, _ := json.Marshal(ref)
+			return map[string]string{utils.Resources[0].TemplateAnnotation: string(val)}
+		}, nil
+	case spec.TopologyFile != "":
+		path := spec.TopologyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return func(string) map[string]string {
+			return map[string]string{utils.Resources[0].TopologyAnnotation: string(data)}
+		}, nil
+	}
+	return nil, fmt.Errorf("either template or topologyFile is required")
+}
+
+func (s *Simulator) addNode(name string, annotations map[string]string) error {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	if err := s.nodeIndexer.Add(node); err != nil {
+		return err
+	}
+	if err := s.pcache.UpdateNodeTopology(node); err != nil {
+		return err
+	}
+	n, err := s.pcache.GetNodeInfo(name)
+	if err != nil {
+		return err
+	}
+	s.nodeNames = append(s.nodeNames, name)
+	s.totalGPUs += len(n.DeviceStates())
+	return nil
+}
+
+// Run replays the trace, the jobs which can't be placed at their arrival wait
+// in FIFO order and are retried whenever a job departs. The trace is
+// validated first.
+func (s *Simulator) Run(trace *Trace) (*Report, error) {
+	if err := trace.Validate(); err != nil {
+		return nil, err
+	}
+	report := &Report{Jobs: len(trace.Jobs), TotalGPUs: s.totalGPUs, IslandSize: s.islandSize}
+
+	var events []event
+	for i := range trace.Jobs {
+		events = append(events, event{time: trace.Jobs[i].Arrival, job: &trace.Jobs[i]})
+	}
+
+	var (
+		pending      []*jobState
+		now, start   float64
+		usedGPUs     int64
+		gpuSeconds   float64
+		waitSum      float64
+		qualitySum   float64
+		qualityJobs  int
+		arrivals     int
+		islandEvents int
+		running      = map[*Job]*jobState{}
+	)
+	if len(events) > 0 {
+		sortEvents(events)
+		start = events[0].time
+		now = start
+	}
+
+	for len(events) > 0 {
+		e := events[0]
+		events = events[1:]
+		gpuSeconds += float64(usedGPUs) * (e.time - now)
+		now = e.time
+
+		if e.departure {
+			st := running[e.job]
+			delete(running, e.job)
+			s.pcache.RemovePod(st.pod)
+			usedGPUs -= e.job.GPUs
+		} else {
+			arrivals++
+			if s.islandAvailable() {
+				islandEvents++
+			}
+			pending = append(pending, &jobState{job: e.job, pod: newPod(e.job)})
+		}
+
+		// place the pending jobs in FIFO order
+		var waiting []*jobState
+		for _, st := range pending {
+			nodeName, assumed := s.schedule(st.pod)
+			if assumed == nil {
+				waiting = append(waiting, st)
+				continue
+			}
+			st.pod, st.start = assumed, now
+			running[st.job] = st
+			usedGPUs += st.job.GPUs
+			report.Placed++
+
+			wait := now - st.job.Arrival
+			waitSum += wait
+			if wait > report.MaxWait {
+				report.MaxWait = wait
+			}
+			if st.job.GPUs > 1 {
+				n, _ := s.pcache.GetNodeInfo(nodeName)
+				qualitySum += float64(n.LinkQuality(splitUUIDs(assumed), s.pcache.GetScoringConfig()))
+				qualityJobs++
+			}
+			events = append(events, event{time: now + st.job.Duration, departure: true, job: st.job})
+			sortEvents(events)
+		}
+		pending = waiting
+	}
+
+	report.Unplaced = len(pending)
+	report.Makespan = now - start
+	if report.Makespan > 0 && s.totalGPUs > 0 {
+		report.GPUUtilization = gpuSeconds / (report.Makespan * float64(s.totalGPUs))
+	}
+	if report.Placed > 0 {
+		report.AverageWait = waitSum / float64(report.Placed)
+	}
+	if qualityJobs > 0 {
+		report.AverageLinkQuality = qualitySum / float64(qualityJobs)
+	}
+	if arrivals > 0 {
+		report.IslandAvailability = float64(islandEvents) / float64(arrivals)
+	}
+	return report, nil
+}
+
+// schedule runs the pod through filter and priority, then assumes it on the
+// best node like the bind does. It returns nil if the pod can't be placed.
+func (s *Simulator) schedule(pod *v1.Pod) (string, *v1.Pod) {
+	nodeNames := append([]string{}, s.nodeNames...)
+	filtered := s.predicate.Handler(schedulerapi.ExtenderArgs{Pod: pod, NodeNames: &nodeNames})
+	if len(*filtered.NodeNames) == 0 {
+		return "", nil
+	}
+	priorities := *s.priority.Handler(schedulerapi.ExtenderArgs{Pod: pod, NodeNames: filtered.NodeNames})
+	sort.SliceStable(priorities, func(i, j int) bool {
+		return priorities[i].Score > priorities[j].Score
+	})
+
+	gpuTopoNum := utils.GetGPUTopoNum(pod)
+	for _, p := range priorities {
+		assumed, err := s.pcache.AssumePod(pod, p.Host, gpuTopoNum, s.pcache.GetScoringConfig())
+		if err != nil {
+			klog.V(2).Infof("Failed to assume pod %s on node %s: %v", pod.Name, p.Host, err)
+			continue
+		}
+		return p.Host, assumed
+	}
+	return "", nil
+}
+
+func (s *Simulator) islandAvailable() bool {
+	for _, name := range s.nodeNames {
+		n, err := s.pcache.GetNodeInfo(name)
+		if err != nil {
+			continue
+		}
+		var free int
+		for _, d := range n.DeviceStates() {
+			if d.Pod == "" && !d.Cordoned && d.Unhealthy == "" {
+				free++
+			}
+		}
+		if free >= s.islandSize {
+			return true
+		}
+	}
+	return false
+}
+
+func newPod(job *Job) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: simNamespace,
+			UID:       types.UID(job.Name),
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: job.Name,
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceName(utils.DefaultResourceName()): *resource.NewQuantity(job.GPUs, resource.DecimalSI),
+					},
+				},
+			}},
+		},
+	}
+	pod.Annotations = map[string]string{}
+	if job.Strategy != "" {
+		pod.Annotations[utils.AnnotationPlacementStrategy] = job.Strategy
+	}
+	if job.Pattern != "" {
+		pod.Annotations[utils.AnnotationCommPattern] = job.Pattern
+	}
+	return pod
+}
+
+func splitUUIDs(pod *v1.Pod) []string {
+	return strings.Split(utils.GetGPUIDFromAnnotation(pod), ",")
+}
+
+// sortEvents orders the events by time, the departures go first so that
+// their GPUs are free for the arrivals at the same time
+func sortEvents(events []event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].departure && !events[j].departure
+	})
+}
@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+)
+
+// Cluster describes the synthetic nodes of the simulation
+type Cluster struct {
+	Nodes []NodeSpec `json:"nodes"`
+	// Scoring replaces the default scoring config of the extender
+	Scoring *cache.ScoringConfig `json:"scoring,omitempty"`
+}
+
+// NodeSpec describes a group of identical nodes, the topology comes from a
+// template or a file in the format of the node annotation
+type NodeSpec struct {
+	Name string `json:"name"`
+	// Count of the nodes, they're named name-0, name-1, ... if it's larger than 1
+	Count        int    `json:"count,omitempty"`
+	Template     string `json:"template,omitempty"`
+	TopologyFile string `json:"topologyFile,omitempty"`
+}
+
+// Trace is the workload replayed by the simulation
+type Trace struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Validate checks the job names are unique, they name the pods, and every
+// job requests GPUs
+func (t *Trace) Validate() error {
+	names := make(map[string]bool, len(t.Jobs))
+	for i, job := range t.Jobs {
+		switch {
+		case job.Name == "":
+			return fmt.Errorf("jobs[%d]: the name is required", i)
+		case names[job.Name]:
+			return fmt.Errorf("jobs[%d]: duplicate name %q", i, job.Name)
+		case job.GPUs <= 0:
+			return fmt.Errorf("jobs[%d] %s: gpus must be positive", i, job.Name)
+		case job.Duration < 0:
+			return fmt.Errorf("jobs[%d] %s: duration must not be negative", i, job.Name)
+		}
+		names[job.Name] = true
+	}
+	return nil
+}
+
+// Job is a pod requesting GPUs for a while
+type Job struct {
+	Name string `json:"name"`
+	// Arrival is the time in seconds when the pod is created
+	Arrival float64 `json:"arrival"`
+	// Duration in seconds the pod runs once it's placed
+	Duration float64 `json:"duration"`
+	GPUs     int64   `json:"gpus"`
+	Strategy string  `json:"strategy,omitempty"`
+	// Pattern is the communication pattern, see utils.AnnotationCommPattern
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// Report summarizes the simulation
+type Report struct {
+	Jobs       int `json:"jobs"`
+	Placed     int `json:"placed"`
+	Unplaced   int `json:"unplaced"`
+	TotalGPUs  int `json:"totalGPUs"`
+	IslandSize int `json:"islandSize"`
+	// Makespan is the time in seconds from the first arrival to the last departure
+	Makespan float64 `json:"makespan"`
+	// GPUUtilization is the time weighted ratio of the allocated GPUs
+	GPUUtilization float64 `json:"gpuUtilization"`
+	// AverageLinkQuality is the average link score in [0, 100] of the multi-GPU jobs
+	AverageLinkQuality float64 `json:"averageLinkQuality"`
+	AverageWait        float64 `json:"averageWait"`
+	MaxWait            float64 `json:"maxWait"`
+	// IslandAvailability is the ratio of the arrivals when a node had
+	// IslandSize free GPUs
+	IslandAvailability float64 `json:"islandAvailability"`
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"k8s.io/api/core/v1"
-	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 )
 
 // AssignedNonTerminatedPod selects pods that are assigned and non-terminal (scheduled and running).
@@ -32,11 +31,11 @@ func IsCompletePod(pod *v1.Pod) bool {
 	return false
 }
 
-// GetGPUIDFromAnnotation gets GPU UUID from Annotation
+// GetGPUIDFromAnnotation gets GPU UUID from the annotation of the managed
+// resource
 func GetGPUIDFromAnnotation(pod *v1.Pod) string {
-	if len(pod.ObjectMeta.Annotations) > 0 {
-		value, found := pod.ObjectMeta.Annotations[ResourceName]
-		if found {
+	for _, r := range Resources {
+		if value, found := pod.ObjectMeta.Annotations[r.Name]; found {
 			return value
 		}
 	}
@@ -44,26 +43,39 @@ func GetGPUIDFromAnnotation(pod *v1.Pod) string {
 	return ""
 }
 
-// IsGPUTopoPod determines if it's the pod for GPU topology
-func IsGPUTopoPod(pod *v1.Pod) bool {
-	return GetGPUTopoNum(pod) > 0
+// GetPlacementStrategy gets the placement strategy from Annotation, binpack by default
+func GetPlacementStrategy(pod *v1.Pod) string {
+	if value, found := pod.ObjectMeta.Annotations[AnnotationPlacementStrategy]; found && value == PlacementStrategySpread {
+		return PlacementStrategySpread
+	}
+	return PlacementStrategyBinpack
 }
 
-// GetGPUTopoNum get GPU related topology number
-func GetGPUTopoNum(pod *v1.Pod) int64 {
-	res := &schedulernodeinfo.Resource{}
-	for _, container := range pod.Spec.Containers {
-		res.Add(container.Resources.Requests)
+// GetCommPattern gets the communication pattern from Annotation, empty if
+// it's not annotated or unknown
+func GetCommPattern(pod *v1.Pod) string {
+	if value := pod.ObjectMeta.Annotations[AnnotationCommPattern]; IsCommPattern(value) {
+		return value
 	}
+	return ""
+}
 
-	// take max_resource(sum_pod, any_init_container)
-	for _, container := range pod.Spec.InitContainers {
-		res.SetMaxResource(container.Resources.Requests)
+// IsCommPattern checks the value is a known communication pattern
+func IsCommPattern(value string) bool {
+	switch value {
+	case CommPatternRing, CommPatternTree, CommPatternAllToAll, CommPatternParameterServer:
+		return true
 	}
+	return false
+}
 
-	resList := res.ResourceList()
-	gpuTopo := resList["nvidia.com/gpu-topo"]
-	gpuTopoNum, _ := gpuTopo.AsInt64()
+// IsGPUTopoPod determines if it's the pod for GPU topology
+func IsGPUTopoPod(pod *v1.Pod) bool {
+	return GetGPUTopoNum(pod) > 0
+}
 
+// GetGPUTopoNum get GPU related topology number
+func GetGPUTopoNum(pod *v1.Pod) int64 {
+	_, gpuTopoNum := GetGPUTopoResource(pod)
 	return gpuTopoNum
 }
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"k8s.io/api/core/v1"
+	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// Resource is an extended resource of the GPUs managed by the extender, the
+// pods record their GPU UUIDs in the annotation of the resource name
+type Resource struct {
+	Name string `json:"name"`
+	// TopologyAnnotation is the node annotation of the topology of its GPUs
+	TopologyAnnotation string `json:"topologyAnnotation"`
+	// TemplateAnnotation is the node annotation of the server model and the
+	// GPU UUIDs, it's used without TopologyAnnotation
+	TemplateAnnotation string `json:"templateAnnotation"`
+	// LinkTypes names the link types of the vendor by the built-in ones,
+	// e.g. XGMI: NV4, they're accepted in the templates and the score table
+	LinkTypes map[string]string `json:"linkTypes,omitempty"`
+}
+
+// DefaultResource is the NVIDIA GPUs
+func DefaultResource() Resource {
+	return Resource{
+		Name:               "nvidia.com/gpu-topo",
+		TopologyAnnotation: AnnotationNodeTopology,
+		TemplateAnnotation: AnnotationNodeTopologyTemplate,
+	}
+}
+
+// Resources are the managed resources, the first one is the default of the
+// nodes and the pods which don't tell theirs. They're set on start.
+var Resources = []Resource{DefaultResource()}
+
+// DefaultResourceName is the name of the first managed resource
+func DefaultResourceName() string {
+	return Resources[0].Name
+}
+
+// GetResource gets the managed resource by its name
+func GetResource(name string) (*Resource, bool) {
+	for i := range Resources {
+		if Resources[i].Name == name {
+			return &Resources[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetNodeResource gets the managed resource whose topology or template
+// annotation the node has
+func GetNodeResource(node *v1.Node) (*Resource, bool) {
+	for i := range Resources {
+		r := &Resources[i]
+		if _, ok := node.Annotations[r.TopologyAnnotation]; ok {
+			return r, true
+		}
+		if _, ok := node.Annotations[r.TemplateAnnotation]; ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// GetGPUTopoResource gets the managed resource the pod requests and its
+// number, the first managed one if it requests several
+func GetGPUTopoResource(pod *v1.Pod) (string, int64) {
+	res := &schedulernodeinfo.Resource{}
+	for _, container := range pod.Spec.Containers {
+		res.Add(container.Resources.Requests)
+	}
+
+	// take max_resource(sum_pod, any_init_container)
+	for _, container := range pod.Spec.InitContainers {
+		res.SetMaxResource(container.Resources.Requests)
+	}
+
+	resList := res.ResourceList()
+	for _, r := range Resources {
+		gpuTopo, ok := resList[v1.ResourceName(r.Name)]
+		if !ok {
+			continue
+		}
+		if gpuTopoNum, _ := gpuTopo.AsInt64(); gpuTopoNum > 0 {
+			return r.Name, gpuTopoNum
+		}
+	}
+	return "", 0
+}
@@ -1,7 +1,47 @@
 package utils
 
 const (
-	ResourceName = "nvidia.com/gpu-topo"
+	// AnnotationNodeTopology is the node annotation which contains the topology
+	AnnotationNodeTopology = "nvidia.com/gpu-topo"
+	// AnnotationNodeTopologyTemplate is the node annotation which contains the
+	// server model and the GPU UUIDs, it's used without AnnotationNodeTopology
+	AnnotationNodeTopologyTemplate = "nvidia.com/gpu-topo-template"
+
+	// AnnotationCordonedDevices is the node annotation of the comma separated
+	// UUIDs of the GPUs taken out of service
+	AnnotationCordonedDevices = "nvidia.com/gpu-topo-cordoned"
+
+	// TaintDegradedTopology is tainted on the nodes with degraded GPU links
+	TaintDegradedTopology = "nvidia.com/gpu-topo-degraded"
+
+	// AnnotationPlacementStrategy is the pod annotation to choose how the GPUs are placed
+	AnnotationPlacementStrategy = "nvidia.com/gpu-topo-strategy"
+	// PlacementStrategyBinpack fills the nodes which are already in use first
+	PlacementStrategyBinpack = "binpack"
+	// PlacementStrategySpread prefers the nodes with more free GPUs
+	PlacementStrategySpread = "spread"
+
+	// AnnotationCommPattern is the pod annotation of the communication
+	// pattern of the job, the GPUs are chosen by the links it stresses
+	AnnotationCommPattern = "nvidia.com/gpu-topo-pattern"
+	// CommPatternRing is a ring allreduce, it needs a good ring through the GPUs
+	CommPatternRing = "ring"
+	// CommPatternTree is a tree allreduce or broadcast, it needs a good
+	// spanning tree of the GPUs
+	CommPatternTree = "tree"
+	// CommPatternAllToAll is an all-to-all exchange, e.g. of the MoE
+	// models, it needs every pair of the GPUs
+	CommPatternAllToAll = "all-to-all"
+	// CommPatternParameterServer is a parameter server, it needs the
+	// workers close to the GPU serving the parameters, which is recorded in
+	// AnnotationParameterServer
+	CommPatternParameterServer = "parameter-server"
+	// AnnotationParameterServer is the pod annotation of the UUID of the GPU
+	// the parameter-server pattern was scored for, the job reads it, e.g.
+	// through the downward API, to serve the parameters from that GPU. The
+	// order of the GPUs in the container follows the CUDA device order,
+	// not the one of the allocation.
+	AnnotationParameterServer = "nvidia.com/gpu-topo-parameter-server"
 
 	EnvNVGPU              = "NVIDIA_VISIBLE_DEVICES"
 	EnvResourceIndex      = "ALIYUN_COM_GPU_MEM_IDX"
@@ -0,0 +1,38 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The build metadata is set at link time, e.g.
+// -ldflags "-X github.com/gpucloud/node-topology-manager/pkg/version.gitCommit=$(git rev-parse HEAD)"
+var (
+	version   = "0.1.0"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// Info is the build metadata of the binary
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get the build metadata
+func Get() Info {
+	return Info{
+		Version:   version,
+		GitCommit: gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s %s)", i.Version, i.GitCommit, i.BuildDate, i.GoVersion, i.Platform)
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/klog"
+)
+
+const (
+	mutatePath = "/mutate"
+
+	// shutdownTimeout bounds the wait for the admission requests in flight
+	shutdownTimeout = 10 * time.Second
+)
+
+// ListenAndServeTLS serves the webhook on addr until stopCh is closed, then
+// waits for the requests in flight. A self-signed certificate for host is
+// generated when certFile or keyFile is empty, it's for local testing.
+func ListenAndServeTLS(addr, certFile, keyFile, host string, m *Mutator, stopCh <-chan struct{}) error {
+	router := httprouter.New()
+	router.POST(mutatePath, m.Handler)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Warningf("Failed to shut down the webhook server: %v", err)
+		}
+	}()
+
+	if certFile != "" && keyFile != "" {
+		klog.Infof("webhook server starting on %s", addr)
+		return ignoreServerClosed(server.ListenAndServeTLS(certFile, keyFile))
+	}
+
+	certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey(host, nil, nil)
+	if err != nil {
+		return err
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{pair}}
+	klog.Infof("webhook server starting on %s with a self-signed certificate for %s", addr, host)
+	klog.V(2).Infof("webhook CA bundle:\n%s", certPEM)
+	return ignoreServerClosed(server.ListenAndServeTLS("", ""))
+}
+
+func ignoreServerClosed(err error) error {
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The admission.k8s.io/v1beta1 types are not vendored, the structs below
+// keep the JSON fields of AdmissionReview used by the webhook.
+
+// AdmissionReview describes an admission review request/response.
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion,omitempty"`
+	Kind       string             `json:"kind,omitempty"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest describes the admission.Attributes for the admission request.
+type AdmissionRequest struct {
+	UID       types.UID            `json:"uid"`
+	Namespace string               `json:"namespace,omitempty"`
+	Operation string               `json:"operation"`
+	Object    runtime.RawExtension `json:"object,omitempty"`
+}
+
+// AdmissionResponse describes an admission response.
+type AdmissionResponse struct {
+	UID       types.UID `json:"uid"`
+	Allowed   bool      `json:"allowed"`
+	Result    *Status   `json:"status,omitempty"`
+	Patch     []byte    `json:"patch,omitempty"`
+	PatchType *string   `json:"patchType,omitempty"`
+}
+
+// Status is the reason returned for a rejected request
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int32  `json:"code,omitempty"`
+}
+
+// patchOperation is a single operation of the JSON patch
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/gpucloud/node-topology-manager/pkg/cache"
+	"github.com/gpucloud/node-topology-manager/pkg/utils"
+)
+
+const (
+	patchTypeJSONPatch = "JSONPatch"
+
+	defaultSchedulerName = "default-scheduler"
+)
+
+// DefaultTolerations are added to the GPU topology pods to tolerate the
+// taint of the GPU nodes
+var DefaultTolerations = []v1.Toleration{
+	{
+		Key:      "nvidia.com/gpu",
+		Operator: v1.TolerationOpExists,
+		Effect:   v1.TaintEffectNoSchedule,
+	},
+}
+
+// Mutator injects the scheduling settings into the GPU topology pods
+type Mutator struct {
+	schedulerName string
+	strategy      string
+	tolerations   []v1.Toleration
+	pcache        *cache.SchedulerCache
+}
+
+// NewMutator return a new mutator for the GPU topology pods
+func NewMutator(schedulerName, strategy string, tolerations []v1.Toleration, c *cache.SchedulerCache) *Mutator {
+	return &Mutator{
+		schedulerName: schedulerName,
+		strategy:      strategy,
+		tolerations:   tolerations,
+		pcache:        c,
+	}
+}
+
+// Handler serves the AdmissionReview from the API server
+func (m *Mutator) Handler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var review AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		klog.Errorf("Failed to parse admission review: %v", err)
+		http.Error(w, "Please send an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = m.admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	resultBody, err := json.Marshal(review)
+	if err != nil {
+		klog.Errorf("Failed to encode admission review: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultBody)
+}
+
+func (m *Mutator) admit(req *AdmissionRequest) *AdmissionResponse {
+	var pod v1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		klog.Errorf("Failed to decode pod: %v", err)
+		return denied(http.StatusBadRequest, err.Error())
+	}
+
+	resource, gpuTopoNum := utils.GetGPUTopoResource(&pod)
+	if gpuTopoNum <= 0 {
+		return &AdmissionResponse{Allowed: true}
+	}
+
+	if value := pod.Annotations[utils.AnnotationCommPattern]; value != "" && !utils.IsCommPattern(value) {
+		klog.V(2).Infof("Reject pod %s in ns %s: unknown communication pattern %q", pod.Name, req.Namespace, value)
+		return denied(http.StatusBadRequest, fmt.Sprintf("unknown %s %q, must be %s, %s, %s or %s", utils.AnnotationCommPattern, value,
+			utils.CommPatternRing, utils.CommPatternTree, utils.CommPatternAllToAll, utils.CommPatternParameterServer))
+	}
+
+	if max := m.pcache.MaxGPUDevices(); max > 0 && gpuTopoNum > int64(max) {
+		klog.V(2).Infof("Reject pod %s in ns %s: it requests %d GPUs, but the largest node has %d", pod.Name, req.Namespace, gpuTopoNum, max)
+		return denied(http.StatusForbidden, fmt.Sprintf("pod requests %d %s, but no node has more than %d", gpuTopoNum, resource, max))
+	}
+
+	patch, err := json.Marshal(m.patches(&pod))
+	if err != nil {
+		return denied(http.StatusInternalServerError, err.Error())
+	}
+	patchType := patchTypeJSONPatch
+	return &AdmissionResponse{
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchType,
+	}
+}
+
+// patches build the JSON patch which sets the scheduler name, the placement
+// strategy and the tolerations which are missing from the pod
+func (m *Mutator) patches(pod *v1.Pod) []patchOperation {
+	var ops []patchOperation
+
+	if m.schedulerName != "" && (pod.Spec.SchedulerName == "" || pod.Spec.SchedulerName == defaultSchedulerName) {
+		ops = append(ops, patchOperation{Op: "add", Path: "/spec/schedulerName", Value: m.schedulerName})
+	}
+
+	if _, ok := pod.Annotations[utils.AnnotationPlacementStrategy]; !ok && m.strategy != "" {
+		if pod.Annotations == nil {
+			ops = append(ops, patchOperation{
+				Op:    "add",
+				Path:  "/metadata/annotations",
+				Value: map[string]string{utils.AnnotationPlacementStrategy: m.strategy},
+			})
+		} else {
+			ops = append(ops, patchOperation{
+				Op:    "add",
+				Path:  "/metadata/annotations/" + escapeJSONPointer(utils.AnnotationPlacementStrategy),
+				Value: m.strategy,
+			})
+		}
+	}
+
+	var missing []v1.Toleration
+	for i := range m.tolerations {
+		if !hasToleration(pod.Spec.Tolerations, &m.tolerations[i]) {
+			missing = append(missing, m.tolerations[i])
+		}
+	}
+	if len(missing) > 0 {
+		if pod.Spec.Tolerations == nil {
+			ops = append(ops, patchOperation{Op: "add", Path: "/spec/tolerations", Value: missing})
+		} else {
+			for _, t := range missing {
+				ops = append(ops, patchOperation{Op: "add", Path: "/spec/tolerations/-", Value: t})
+			}
+		}
+	}
+
+	return ops
+}
+
+func hasToleration(tolerations []v1.Toleration, t *v1.Toleration) bool {
+	for i := range tolerations {
+		if tolerations[i].MatchToleration(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func denied(code int32, msg string) *AdmissionResponse {
+	return &AdmissionResponse{
+		Allowed: false,
+		Result: &Status{
+			Message: msg,
+			Code:    code,
+		},
+	}
+}
+
+// escapeJSONPointer escapes the key to be used in the JSON patch path
+func escapeJSONPointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}